@@ -0,0 +1,256 @@
+package elasticsearch
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// http://www.elasticsearch.org/guide/reference/api/admin-cluster-health/
+// If Index is set, the health is only of that index, or of each index in a
+// comma-separated list. If WaitForStatus is set
+// (green, yellow, or red), the request blocks until the cluster reaches at
+// least that status, or the Timeout (eg. "30s") elapses.
+type ClusterHealthRequest struct {
+	Index         string
+	WaitForStatus string
+	Timeout       string
+}
+
+func (r ClusterHealthRequest) Request(uri *url.URL) (*http.Request, error) {
+	switch r.WaitForStatus {
+	case "", "green", "yellow", "red":
+	default:
+		return nil, fmt.Errorf("cluster health: invalid wait_for_status %q", r.WaitForStatus)
+	}
+
+	uri.Path = "/_cluster/health"
+	uri.RawPath = ""
+	if r.Index != "" {
+		names := strings.Split(r.Index, ",")
+		escaped := make([]string, len(names))
+		for i, name := range names {
+			escaped[i] = url.PathEscape(name)
+		}
+		uri.Path += "/" + r.Index
+		uri.RawPath = "/_cluster/health/" + strings.Join(escaped, ",")
+	}
+	uri.RawQuery = values(map[string]string{
+		"wait_for_status": r.WaitForStatus,
+		"timeout":         r.Timeout,
+	}).Encode()
+
+	return http.NewRequest("GET", uri.String(), nil)
+}
+
+type ClusterHealthResponse struct {
+	ClusterName         string `json:"cluster_name"`
+	Status              string `json:"status"`
+	TimedOut            bool   `json:"timed_out"`
+	NumberOfNodes       int    `json:"number_of_nodes"`
+	NumberOfDataNodes   int    `json:"number_of_data_nodes"`
+	ActivePrimaryShards int    `json:"active_primary_shards"`
+	ActiveShards        int    `json:"active_shards"`
+	RelocatingShards    int    `json:"relocating_shards"`
+	InitializingShards  int    `json:"initializing_shards"`
+	UnassignedShards    int    `json:"unassigned_shards"`
+
+	Error string `json:"error,omitempty"`
+}
+
+// http://www.elasticsearch.org/guide/reference/api/admin-cluster-stats/
+type ClusterStatsRequest struct{}
+
+func (r ClusterStatsRequest) Request(uri *url.URL) (*http.Request, error) {
+	uri.Path = "/_cluster/stats"
+	return http.NewRequest("GET", uri.String(), nil)
+}
+
+// ClusterStatsResponse decodes the commonly-used parts of the cluster stats.
+// The node stats vary between versions of ElasticSearch, so they're left raw.
+type ClusterStatsResponse struct {
+	ClusterName string `json:"cluster_name"`
+	Status      string `json:"status"`
+
+	Indices struct {
+		Count int `json:"count"`
+		Docs  struct {
+			Count int64 `json:"count"`
+		} `json:"docs"`
+		Store struct {
+			SizeInBytes int64 `json:"size_in_bytes"`
+		} `json:"store"`
+	} `json:"indices"`
+
+	Nodes json.RawMessage `json:"nodes"`
+
+	Error string `json:"error,omitempty"`
+}
+
+//
+//
+//
+
+// http://www.elasticsearch.org/guide/reference/api/admin-indices-stats/
+// No Indices means all indices.
+type IndexStatsRequest struct {
+	Indices []string
+}
+
+func (r IndexStatsRequest) Request(uri *url.URL) (*http.Request, error) {
+	uri.Path = SearchParams{Indices: r.Indices}.path("_stats")
+	return http.NewRequest("GET", uri.String(), nil)
+}
+
+// IndexStatsResponse carries the stats summed over all requested indices, in
+// All, and for each index by name.
+type IndexStatsResponse struct {
+	All     IndexStats            `json:"_all"`
+	Indices map[string]IndexStats `json:"indices"`
+
+	Error string `json:"error,omitempty"`
+}
+
+// UnmarshalJSON accepts the error as either a string, or an object.
+func (r *IndexStatsResponse) UnmarshalJSON(data []byte) error {
+	type response IndexStatsResponse // without this method, to avoid recursion
+	return unmarshalWithError(data, (*response)(r), &r.Error)
+}
+
+// IndexStats separates the stats of primary shards from those of all shards,
+// ie. including replicas.
+type IndexStats struct {
+	Primaries ShardStats `json:"primaries"`
+	Total     ShardStats `json:"total"`
+}
+
+type ShardStats struct {
+	Docs struct {
+		Count   int64 `json:"count"`
+		Deleted int64 `json:"deleted"`
+	} `json:"docs"`
+	Store struct {
+		SizeInBytes int64 `json:"size_in_bytes"`
+	} `json:"store"`
+}
+
+//
+//
+//
+
+// AcknowledgedResponse is the reply to admin requests which only report
+// whether they were acknowledged by the cluster.
+type AcknowledgedResponse struct {
+	Acknowledged bool `json:"acknowledged"`
+
+	Error  string `json:"error,omitempty"`
+	Status int    `json:"status,omitempty"`
+}
+
+// UnmarshalJSON accepts the error as either a string, or an object.
+func (r *AcknowledgedResponse) UnmarshalJSON(data []byte) error {
+	type response AcknowledgedResponse // without this method, to avoid recursion
+	return unmarshalWithError(data, (*response)(r), &r.Error)
+}
+
+// http://www.elasticsearch.org/guide/reference/api/admin-indices-get-settings/
+// No Indices means all indices.
+type GetSettingsRequest struct {
+	Indices []string
+}
+
+func (r GetSettingsRequest) Request(uri *url.URL) (*http.Request, error) {
+	uri.Path = SearchParams{Indices: r.Indices}.path("_settings")
+	return http.NewRequest("GET", uri.String(), nil)
+}
+
+// GetSettingsResponse maps each index name to its settings in Indices, unless
+// the request failed, eg. for a missing index.
+type GetSettingsResponse struct {
+	Indices map[string]IndexSettings
+
+	Error  string
+	Status int
+}
+
+// UnmarshalJSON tells an error reply, which has a numeric status, from the
+// settings of indices which happen to be named "error" or "status".
+func (r *GetSettingsResponse) UnmarshalJSON(data []byte) error {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+
+	var status int
+	if raw, ok := fields["status"]; ok && json.Unmarshal(raw, &status) == nil {
+		*r = GetSettingsResponse{Error: errorString(fields["error"]), Status: status}
+		return nil
+	}
+
+	*r = GetSettingsResponse{Indices: map[string]IndexSettings{}}
+	for name, raw := range fields {
+		var settings IndexSettings
+		if err := json.Unmarshal(raw, &settings); err != nil {
+			return fmt.Errorf("index %q: %s", name, err)
+		}
+		r.Indices[name] = settings
+	}
+	return nil
+}
+
+type IndexSettings struct {
+	Settings map[string]interface{} `json:"settings"`
+}
+
+// http://www.elasticsearch.org/guide/reference/api/admin-indices-update-settings/
+// Settings are the settings to change, eg.
+// `{"index": {"refresh_interval": "1s"}}`. No Indices means all indices.
+type UpdateSettingsRequest struct {
+	Indices  []string
+	Settings map[string]interface{}
+}
+
+func (r UpdateSettingsRequest) Request(uri *url.URL) (*http.Request, error) {
+	if len(r.Settings) <= 0 {
+		return nil, fmt.Errorf("update settings: no settings specified")
+	}
+
+	uri.Path = SearchParams{Indices: r.Indices}.path("_settings")
+
+	buf := new(bytes.Buffer)
+	if err := json.NewEncoder(buf).Encode(r.Settings); err != nil {
+		return nil, err
+	}
+
+	return newRequest("PUT", uri.String(), contentTypeJSON, buf)
+}
+
+// http://www.elasticsearch.org/guide/reference/api/admin-indices-open-close/
+type OpenIndexRequest struct {
+	Index string
+}
+
+func (r OpenIndexRequest) Request(uri *url.URL) (*http.Request, error) {
+	return openCloseRequest(uri, r.Index, "_open")
+}
+
+// http://www.elasticsearch.org/guide/reference/api/admin-indices-open-close/
+type CloseIndexRequest struct {
+	Index string
+}
+
+func (r CloseIndexRequest) Request(uri *url.URL) (*http.Request, error) {
+	return openCloseRequest(uri, r.Index, "_close")
+}
+
+func openCloseRequest(uri *url.URL, index, endpoint string) (*http.Request, error) {
+	if index == "" {
+		return nil, fmt.Errorf("%s: no index specified", endpoint)
+	}
+
+	IndexParams{Index: index}.setPath(uri, endpoint)
+	return http.NewRequest("POST", uri.String(), nil)
+}
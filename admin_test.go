@@ -0,0 +1,288 @@
+package elasticsearch_test
+
+import (
+	"encoding/json"
+	es "github.com/peterbourgon/elasticsearch"
+	"io/ioutil"
+	"net/url"
+	"testing"
+)
+
+func TestClusterHealthRequest(t *testing.T) {
+	for _, tuple := range []struct {
+		r     es.ClusterHealthRequest
+		path  string
+		query string
+	}{
+		{
+			r:    es.ClusterHealthRequest{},
+			path: "/_cluster/health",
+		},
+		{
+			r:     es.ClusterHealthRequest{Index: "twitter", WaitForStatus: "yellow", Timeout: "50s"},
+			path:  "/_cluster/health/twitter",
+			query: "timeout=50s&wait_for_status=yellow",
+		},
+		{
+			r:    es.ClusterHealthRequest{Index: "twitter,facebook"},
+			path: "/_cluster/health/twitter,facebook",
+		},
+		{
+			r:    es.ClusterHealthRequest{Index: "a/b?c"},
+			path: "/_cluster/health/a%2Fb%3Fc",
+		},
+	} {
+		request, err := tuple.r.Request(&url.URL{})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if expected, got := "GET", request.Method; expected != got {
+			t.Errorf("expected method = %q; got %q", expected, got)
+		}
+
+		if expected, got := tuple.path, request.URL.EscapedPath(); expected != got {
+			t.Errorf("expected path = %q; got %q", expected, got)
+		}
+
+		if expected, got := tuple.query, request.URL.RawQuery; expected != got {
+			t.Errorf("expected query = %q; got %q", expected, got)
+		}
+	}
+
+	if _, err := (es.ClusterHealthRequest{WaitForStatus: "blue"}).Request(&url.URL{}); err == nil {
+		t.Errorf("expected error with invalid wait_for_status, got none")
+	}
+}
+
+func TestClusterHealthResponse(t *testing.T) {
+	data := []byte(`{
+		"cluster_name": "testcluster",
+		"status": "green",
+		"timed_out": false,
+		"number_of_nodes": 2,
+		"number_of_data_nodes": 2,
+		"active_primary_shards": 5,
+		"active_shards": 10,
+		"relocating_shards": 0,
+		"initializing_shards": 0,
+		"unassigned_shards": 0
+	}`)
+
+	var response es.ClusterHealthResponse
+	if err := json.Unmarshal(data, &response); err != nil {
+		t.Fatal(err)
+	}
+
+	if expected, got := "green", response.Status; expected != got {
+		t.Errorf("expected status = %q; got %q", expected, got)
+	}
+
+	if expected, got := 2, response.NumberOfNodes; expected != got {
+		t.Errorf("expected number_of_nodes = %d; got %d", expected, got)
+	}
+
+	if expected, got := 10, response.ActiveShards; expected != got {
+		t.Errorf("expected active_shards = %d; got %d", expected, got)
+	}
+}
+
+func TestClusterStats(t *testing.T) {
+	request, err := es.ClusterStatsRequest{}.Request(&url.URL{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expected, got := "/_cluster/stats", request.URL.Path; expected != got {
+		t.Errorf("expected path = %q; got %q", expected, got)
+	}
+
+	data := []byte(`{
+		"cluster_name": "testcluster",
+		"status": "yellow",
+		"indices": {"count": 3, "docs": {"count": 1234}, "store": {"size_in_bytes": 56789}},
+		"nodes": {"count": {"total": 1}}
+	}`)
+
+	var response es.ClusterStatsResponse
+	if err := json.Unmarshal(data, &response); err != nil {
+		t.Fatal(err)
+	}
+
+	if expected, got := 3, response.Indices.Count; expected != got {
+		t.Errorf("expected indices count = %d; got %d", expected, got)
+	}
+
+	if expected, got := int64(1234), response.Indices.Docs.Count; expected != got {
+		t.Errorf("expected docs count = %d; got %d", expected, got)
+	}
+
+	if expected, got := `{"count": {"total": 1}}`, string(response.Nodes); expected != got {
+		t.Errorf("expected nodes = %s; got %s", expected, got)
+	}
+}
+
+func TestIndexStatsRequest(t *testing.T) {
+	for _, tuple := range []struct {
+		indices []string
+		path    string
+	}{
+		{nil, "/_stats"},
+		{[]string{"twitter"}, "/twitter/_stats"},
+		{[]string{"twitter", "blog"}, "/twitter,blog/_stats"},
+	} {
+		request, err := es.IndexStatsRequest{Indices: tuple.indices}.Request(&url.URL{})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if expected, got := tuple.path, request.URL.Path; expected != got {
+			t.Errorf("expected path = %q; got %q", expected, got)
+		}
+	}
+}
+
+func TestIndexStatsResponse(t *testing.T) {
+	data := []byte(`{
+		"_shards": {"total": 10, "successful": 5, "failed": 0},
+		"_all": {
+			"primaries": {"docs": {"count": 100, "deleted": 2}, "store": {"size_in_bytes": 4096}},
+			"total": {"docs": {"count": 200, "deleted": 4}, "store": {"size_in_bytes": 8192}}
+		},
+		"indices": {
+			"twitter": {
+				"primaries": {"docs": {"count": 100, "deleted": 2}, "store": {"size_in_bytes": 4096}},
+				"total": {"docs": {"count": 200, "deleted": 4}, "store": {"size_in_bytes": 8192}}
+			}
+		}
+	}`)
+
+	var response es.IndexStatsResponse
+	if err := json.Unmarshal(data, &response); err != nil {
+		t.Fatal(err)
+	}
+
+	if expected, got := int64(100), response.All.Primaries.Docs.Count; expected != got {
+		t.Errorf("expected _all.primaries.docs.count = %d; got %d", expected, got)
+	}
+
+	if expected, got := int64(8192), response.All.Total.Store.SizeInBytes; expected != got {
+		t.Errorf("expected _all.total.store.size_in_bytes = %d; got %d", expected, got)
+	}
+
+	twitter, ok := response.Indices["twitter"]
+	if !ok {
+		t.Fatal("twitter stats were not decoded")
+	}
+
+	if expected, got := int64(2), twitter.Primaries.Docs.Deleted; expected != got {
+		t.Errorf("expected twitter primaries.docs.deleted = %d; got %d", expected, got)
+	}
+}
+
+func TestGetSettings(t *testing.T) {
+	request, err := es.GetSettingsRequest{Indices: []string{"twitter"}}.Request(&url.URL{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expected, got := "GET", request.Method; expected != got {
+		t.Errorf("expected method = %q; got %q", expected, got)
+	}
+
+	if expected, got := "/twitter/_settings", request.URL.Path; expected != got {
+		t.Errorf("expected path = %q; got %q", expected, got)
+	}
+
+	var response es.GetSettingsResponse
+	if err := json.Unmarshal([]byte(`{"twitter":{"settings":{"index.number_of_replicas":"1"}}}`), &response); err != nil {
+		t.Fatal(err)
+	}
+
+	if expected, got := "1", response.Indices["twitter"].Settings["index.number_of_replicas"]; expected != got {
+		t.Errorf("expected index.number_of_replicas = %v; got %v", expected, got)
+	}
+}
+
+func TestGetSettingsMissingIndex(t *testing.T) {
+	var response es.GetSettingsResponse
+	if err := json.Unmarshal([]byte(`{"error":{"type":"index_not_found_exception","reason":"no such index"},"status":404}`), &response); err != nil {
+		t.Fatal(err)
+	}
+
+	if expected, got := "index_not_found_exception: no such index", response.Error; expected != got {
+		t.Errorf("expected error = %q; got %q", expected, got)
+	}
+	if expected, got := 404, response.Status; expected != got {
+		t.Errorf("expected status = %d; got %d", expected, got)
+	}
+	if len(response.Indices) != 0 {
+		t.Errorf("expected no indices; got %v", response.Indices)
+	}
+}
+
+func TestUpdateSettingsRequest(t *testing.T) {
+	request, err := es.UpdateSettingsRequest{
+		Indices: []string{"twitter", "blog"},
+		Settings: map[string]interface{}{
+			"index": map[string]interface{}{
+				"refresh_interval":   "-1",
+				"number_of_replicas": 0,
+			},
+		},
+	}.Request(&url.URL{})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expected, got := "PUT", request.Method; expected != got {
+		t.Errorf("expected method = %q; got %q", expected, got)
+	}
+
+	if expected, got := "/twitter,blog/_settings", request.URL.Path; expected != got {
+		t.Errorf("expected path = %q; got %q", expected, got)
+	}
+
+	body, err := ioutil.ReadAll(request.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expected, got := `{"index":{"number_of_replicas":0,"refresh_interval":"-1"}}`+"\n", string(body); expected != got {
+		t.Errorf("expected body = %q; got %q", expected, got)
+	}
+
+	if _, err := (es.UpdateSettingsRequest{Indices: []string{"twitter"}}).Request(&url.URL{}); err == nil {
+		t.Errorf("expected error with no settings, got none")
+	}
+}
+
+func TestOpenCloseIndexRequest(t *testing.T) {
+	for _, tuple := range []struct {
+		f    es.Fireable
+		path string
+	}{
+		{es.OpenIndexRequest{Index: "twitter"}, "/twitter/_open"},
+		{es.CloseIndexRequest{Index: "twitter"}, "/twitter/_close"},
+	} {
+		request, err := tuple.f.Request(&url.URL{})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if expected, got := "POST", request.Method; expected != got {
+			t.Errorf("expected method = %q; got %q", expected, got)
+		}
+
+		if expected, got := tuple.path, request.URL.Path; expected != got {
+			t.Errorf("expected path = %q; got %q", expected, got)
+		}
+	}
+
+	for _, f := range []es.Fireable{es.OpenIndexRequest{}, es.CloseIndexRequest{}} {
+		if _, err := f.Request(&url.URL{}); err == nil {
+			t.Errorf("%T: expected error with no index, got none", f)
+		}
+	}
+}
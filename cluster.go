@@ -1,50 +1,179 @@
 package elasticsearch
 
 import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"sync"
 	"time"
 )
 
+// Client is the interface that groups the read and write methods. Code that
+// depends on a Client, rather than a Cluster, can be tested with a double.
+type Client interface {
+	Searcher
+	MultiSearcher
+	Indexer
+}
+
+var _ Client = (*Cluster)(nil)
+
 // A Cluster is an actively-managed collection of Nodes. Cluster implements
 // Searcher, so you can treat it as a single entity. Its Search method chooses
 // the best Node to receive the Request.
 type Cluster struct {
+	sync.RWMutex // guards nodes; only the loop changes it
 	nodes        Nodes
+	config       nodeConfig
 	pingInterval time.Duration
+	hooks        Hooks
+	changes      chan nodeChange
 	shutdown     chan chan bool
 }
 
+// nodeChange adds or removes the Node with the endpoint, in the loop.
+type nodeChange struct {
+	endpoint string
+	add      bool
+	done     chan error
+}
+
+// A ClusterOption changes some default behavior of a Cluster, and its Nodes.
+// ClusterOptions are passed to NewCluster.
+type ClusterOption func(*Cluster)
+
+// WithRequestTimeout bounds the time taken by each request against a Node,
+// including reading the response. It's independent of the ping timeout. By
+// default, requests have no timeout.
+func WithRequestTimeout(d time.Duration) ClusterOption {
+	return func(c *Cluster) { c.config.requestTimeout = d }
+}
+
+// WithMaxResponseSize limits the size of responses that will be read from
+// any Node. Larger responses fail with ErrResponseTooLarge. By default, the
+// size of responses isn't limited.
+func WithMaxResponseSize(bytes int64) ClusterOption {
+	return func(c *Cluster) { c.config.maxResponseSize = bytes }
+}
+
+// WithCircuitBreaker takes a Node out of rotation, by treating it as Red,
+// after threshold consecutive requests against it fail. A request fails if it
+// can't be made, or if the server replies with a 5xx status. After cooldown,
+// the Node is given exactly one more request, and stays out of rotation until
+// it completes: if it succeeds, the Node is restored; otherwise, it's taken out
+// of rotation again. By default, Nodes are judged by their pings alone.
+func WithCircuitBreaker(threshold int, cooldown time.Duration) ClusterOption {
+	return func(c *Cluster) {
+		c.config.breakerThreshold = threshold
+		c.config.breakerCooldown = cooldown
+	}
+}
+
+// WithTLSConfig sets the TLS configuration used to connect to https
+// endpoints, for both requests and pings. Use it to present client
+// certificates, or to trust a custom certificate authority. By default, the
+// host's root certificate authorities are trusted, and no client certificate
+// is presented.
+func WithTLSConfig(config *tls.Config) ClusterOption {
+	return func(c *Cluster) { c.config.tlsConfig = config }
+}
+
+// WithPing changes how Nodes are pinged: with a GET of path, whose response
+// is judged healthy by ok. Either may be left empty, to keep its default. By
+// default, a GET of "/" which returns HTTP 200 is healthy, which works across
+// ElasticSearch versions.
+func WithPing(path string, ok func(*http.Response) bool) ClusterOption {
+	return func(c *Cluster) {
+		c.config.pingPath = path
+		c.config.pingOK = ok
+	}
+}
+
+// Logger receives diagnostics, such as failed pings. A *log.Logger is a Logger.
+type Logger interface {
+	Printf(format string, args ...interface{})
+}
+
+// WithLogger sends diagnostics to the passed Logger. By default, they go to
+// the standard logger, via log.Printf. To discard them, pass a Logger which
+// writes to ioutil.Discard.
+func WithLogger(logger Logger) ClusterOption {
+	return func(c *Cluster) { c.config.logger = logger }
+}
+
+// Hooks are callbacks invoked around each request that the Cluster executes
+// against a Node, eg. to collect metrics. They're called synchronously, so
+// they should be cheap. Either may be nil.
+type Hooks struct {
+	// OnRequest is called before the request is sent to the Node.
+	OnRequest func(f Fireable, endpoint string)
+
+	// OnResponse is called once the response has been decoded, or the
+	// request has failed, with the time taken and any error.
+	OnResponse func(f Fireable, endpoint string, took time.Duration, err error)
+}
+
+// WithHooks registers callbacks around each request. Requests which can't be
+// sent, because no Node is healthy, don't trigger the Hooks.
+func WithHooks(hooks Hooks) ClusterOption {
+	return func(c *Cluster) { c.hooks = hooks }
+}
+
 // NewCluster returns a new, actively-managed Cluster, representing the
 // passed endpoints as Nodes. Each endpoint should be of the form
 // scheme://host:port, for example http://es001:9200.
 //
 // The Cluster will ping each Node on a schedule dictated by pingInterval.
 // Each node has pingTimeout to respond before the ping is marked as failed.
+// A Node which keeps failing pings is pinged less often, backing off to once
+// every 32 ping intervals, until it answers again.
+//
+// Further options may be passed to change the default behavior of the Cluster.
 //
 // TODO node discovery from the list of seed-nodes.
-func NewCluster(endpoints []string, pingInterval, pingTimeout time.Duration) *Cluster {
-	nodes := Nodes{}
-	for _, endpoint := range endpoints {
-		nodes = append(nodes, NewNode(endpoint, pingTimeout))
-	}
-
+func NewCluster(endpoints []string, pingInterval, pingTimeout time.Duration, options ...ClusterOption) *Cluster {
 	c := &Cluster{
-		nodes:        nodes,
+		nodes:        Nodes{},
+		config:       nodeConfig{pingTimeout: pingTimeout},
 		pingInterval: pingInterval,
+		changes:      make(chan nodeChange),
 		shutdown:     make(chan chan bool),
 	}
+	for _, option := range options {
+		option(c)
+	}
+	for _, endpoint := range endpoints {
+		c.nodes = append(c.nodes, newNode(endpoint, c.config))
+	}
 	go c.loop()
 	return c
 }
 
 // loop is the event dispatcher for a Cluster. It manages the regular pinging of
-// Nodes, and serves incoming requests. Because every request against the
-// cluster must pass through here, it cannot block.
+// Nodes, and serializes changes to them via AddNode and RemoveNode. Requests
+// don't pass through here: they read the Nodes under the Cluster's lock.
+//
+// At most one round of pings is in flight at a time: if the previous round
+// hasn't completed by the next tick, that tick is skipped.
 func (c *Cluster) loop() {
 	ticker := time.Tick(c.pingInterval)
+	pinged := make(chan bool, 1) // buffered, so a round can finish after shutdown
+	pinging := false
 	for {
 		select {
 		case <-ticker:
-			go c.nodes.pingAll()
+			if pinging {
+				continue
+			}
+			pinging = true
+			nodes := c.getNodes()
+			go func() { nodes.pingAll(); pinged <- true }()
+
+		case <-pinged:
+			pinging = false
+
+		case change := <-c.changes:
+			change.done <- c.apply(change)
 
 		case q := <-c.shutdown:
 			q <- true
@@ -53,6 +182,131 @@ func (c *Cluster) loop() {
 	}
 }
 
+// apply makes the change to the Nodes. It never modifies the Nodes slice in
+// place, so that a round of pings over the previous slice is unaffected.
+func (c *Cluster) apply(change nodeChange) error {
+	c.Lock()
+	defer c.Unlock()
+
+	nodes := Nodes{}
+	found := false
+	for _, node := range c.nodes {
+		if node.endpoint == change.endpoint {
+			found = true
+			if !change.add {
+				continue
+			}
+		}
+		nodes = append(nodes, node)
+	}
+
+	switch {
+	case change.add && found:
+		return fmt.Errorf("node %q already exists", change.endpoint)
+	case change.add:
+		nodes = append(nodes, newNode(change.endpoint, c.config))
+	case !found:
+		return fmt.Errorf("no node with endpoint %q", change.endpoint)
+	}
+
+	c.nodes = nodes
+	return nil
+}
+
+// AddNode adds a Node with the endpoint to the Cluster. Like the Nodes given
+// to NewCluster, it's pinged on the next ping interval, but may receive
+// requests before then. It returns an error if the Cluster already has a Node
+// with the endpoint. It mustn't be called after Shutdown.
+func (c *Cluster) AddNode(endpoint string) error {
+	return c.change(nodeChange{endpoint: endpoint, add: true})
+}
+
+// RemoveNode removes the Node with the endpoint from the Cluster. Requests
+// already being executed against the Node are unaffected. It returns an error
+// if the Cluster has no Node with the endpoint. It mustn't be called after
+// Shutdown.
+func (c *Cluster) RemoveNode(endpoint string) error {
+	return c.change(nodeChange{endpoint: endpoint, add: false})
+}
+
+// getNodes returns the current Nodes. The slice mustn't be modified.
+func (c *Cluster) getNodes() Nodes {
+	c.RLock()
+	defer c.RUnlock()
+	return c.nodes
+}
+
+func (c *Cluster) change(change nodeChange) error {
+	change.done = make(chan error)
+	c.changes <- change
+	return <-change.done
+}
+
+// WaitReady blocks until at least one Node has answered a ping, or the
+// timeout elapses. New Nodes are given the benefit of the doubt, so requests
+// against a new Cluster are attempted even before any Node has been reached;
+// use WaitReady to avoid them failing while the Cluster is still coming up.
+func (c *Cluster) WaitReady(timeout time.Duration) error {
+	giveUp := time.After(timeout)
+	for {
+		pinged := make(chan bool, 1)
+		go func() { pinged <- c.getNodes().pingAllNow() }()
+
+		select {
+		case ok := <-pinged:
+			if ok {
+				return nil
+			}
+		case <-giveUp:
+			return fmt.Errorf("no nodes ready after %s", timeout)
+		}
+
+		select {
+		case <-time.After(waitReadyInterval):
+		case <-giveUp:
+			return fmt.Errorf("no nodes ready after %s", timeout)
+		}
+	}
+}
+
+// waitReadyInterval is how often WaitReady pings the Nodes.
+const waitReadyInterval = 50 * time.Millisecond
+
+// ServerVersion returns the lowest ElasticSearch version reported by any Node,
+// eg. "6.8.23", so that requests use only features every Node supports. It's
+// empty until a Node has reported its version. See Node.Version.
+func (c *Cluster) ServerVersion() string {
+	lowest := ""
+	for _, node := range c.getNodes() {
+		if v := node.Version(); v != "" && (lowest == "" || compareVersions(v, lowest) < 0) {
+			lowest = v
+		}
+	}
+	return lowest
+}
+
+// versionedFireable is implemented by Fireables whose wire format depends on
+// the ElasticSearch version. Given an empty version, they should behave as if
+// they weren't versioned.
+type versionedFireable interface {
+	withServerVersion(version string) Fireable
+}
+
+// versioned returns the Fireable adapted to the ServerVersion, if it cares.
+func (c *Cluster) versioned(f Fireable) Fireable {
+	if v, ok := f.(versionedFireable); ok {
+		return v.withServerVersion(c.ServerVersion())
+	}
+	return f
+}
+
+// Healthy returns true if any Node is healthy enough to receive requests. It's
+// cheap, and suitable for eg. a readiness probe.
+func (c *Cluster) Healthy() bool {
+	_, err := c.getNodes().getBest()
+	return err == nil
+}
+
 // Search implements the Searcher interface for a Cluster. It executes the
 // request against a suitable node.
 func (c *Cluster) Search(r SearchRequest) (response SearchResponse, err error) {
@@ -60,6 +314,21 @@ func (c *Cluster) Search(r SearchRequest) (response SearchResponse, err error) {
 	return
 }
 
+// CountViaSearch returns the total number of hits for the request, without
+// transporting any of them: the search is made with a size of 0. Against
+// ElasticSearch 7 and later, which by default stops counting at 10000 hits,
+// it asks for the total to be tracked exactly.
+func (c *Cluster) CountViaSearch(r SearchRequest) (int, error) {
+	var response SearchResponse
+	if err := c.Execute(countRequest{r}, &response); err != nil {
+		return 0, err
+	}
+	if response.Error != "" {
+		return 0, fmt.Errorf("%s (status %d)", response.Error, response.Status)
+	}
+	return response.HitsWrapper.Total, nil
+}
+
 // MultiSearch implements the MultiSearcher interface for a Cluster. It
 // executes the search request against a suitable node.
 func (c *Cluster) MultiSearch(r MultiSearchRequest) (response MultiSearchResponse, err error) {
@@ -67,6 +336,41 @@ func (c *Cluster) MultiSearch(r MultiSearchRequest) (response MultiSearchRespons
 	return
 }
 
+func (c *Cluster) DeleteByQuery(r DeleteByQueryRequest) (response DeleteByQueryResponse, err error) {
+	err = c.Execute(r, &response)
+	return
+}
+
+func (c *Cluster) UpdateByQuery(r UpdateByQueryRequest) (response UpdateByQueryResponse, err error) {
+	err = c.Execute(r, &response)
+	return
+}
+
+func (c *Cluster) Explain(r ExplainRequest) (response ExplainResponse, err error) {
+	err = c.Execute(r, &response)
+	return
+}
+
+func (c *Cluster) ValidateQuery(r ValidateQueryRequest) (response ValidateQueryResponse, err error) {
+	err = c.Execute(r, &response)
+	return
+}
+
+func (c *Cluster) Reindex(r ReindexRequest) (response ReindexResponse, err error) {
+	err = c.Execute(r, &response)
+	return
+}
+
+func (c *Cluster) Get(r GetRequest) (response GetResponse, err error) {
+	err = c.Execute(r, &response)
+	return
+}
+
+func (c *Cluster) TermVectors(r TermVectorsRequest) (response TermVectorsResponse, err error) {
+	err = c.Execute(r, &response)
+	return
+}
+
 func (c *Cluster) Index(r IndexRequest) (response IndexResponse, err error) {
 	err = c.Execute(r, &response)
 	return
@@ -92,15 +396,121 @@ func (c *Cluster) Bulk(r BulkRequest) (response BulkResponse, err error) {
 	return
 }
 
+// BulkParallel executes each batch as a separate Bulk request, with up to
+// concurrency of them in flight at once. Each request is sent to the best Node
+// at the time, so batches are spread across healthy Nodes. The responses and
+// errors correspond, by index, to the batches.
+func (c *Cluster) BulkParallel(batches [][]BulkIndexable, concurrency int) ([]BulkResponse, []error) {
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+
+	var (
+		responses = make([]BulkResponse, len(batches))
+		errs      = make([]error, len(batches))
+		indices   = make(chan int)
+		wg        sync.WaitGroup
+	)
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indices {
+				responses[i], errs[i] = c.Bulk(BulkRequest{Requests: batches[i]})
+			}
+		}()
+	}
+	for i := range batches {
+		indices <- i
+	}
+	close(indices)
+	wg.Wait()
+
+	return responses, errs
+}
+
 // Executes the request against a suitable node and decodes server's reply into
 // response.
 func (c *Cluster) Execute(f Fireable, response interface{}) error {
-	node, err := c.nodes.getBest()
+	node, err := c.getNodes().acquireBest()
 	if err != nil {
 		return err
 	}
 
-	return node.Execute(f, response)
+	return c.execute(node, f, response)
+}
+
+// ExecuteOn is like Execute, but against the Node with the given endpoint,
+// regardless of its health. It returns an error if the Cluster has no such
+// Node.
+func (c *Cluster) ExecuteOn(endpoint string, f Fireable, response interface{}) error {
+	for _, node := range c.getNodes() {
+		if node.endpoint == endpoint {
+			return c.execute(node, f, response)
+		}
+	}
+	return fmt.Errorf("no node with endpoint %q", endpoint)
+}
+
+// execute runs the Fireable against the Node, calling any Hooks around it.
+func (c *Cluster) execute(node *Node, f Fireable, response interface{}) error {
+	if c.hooks.OnRequest != nil {
+		c.hooks.OnRequest(f, node.endpoint)
+	}
+	began := time.Now()
+	err := node.Execute(c.versioned(f), response)
+	if c.hooks.OnResponse != nil {
+		c.hooks.OnResponse(f, node.endpoint, time.Since(began), err)
+	}
+	return err
+}
+
+// Health returns the health of the cluster, as reported by ElasticSearch. It's
+// distinct from Healthy, which reports the Cluster's view of its Nodes.
+func (c *Cluster) Health(r ClusterHealthRequest) (response ClusterHealthResponse, err error) {
+	err = c.Execute(r, &response)
+	return
+}
+
+func (c *Cluster) Stats(r ClusterStatsRequest) (response ClusterStatsResponse, err error) {
+	err = c.Execute(r, &response)
+	return
+}
+
+func (c *Cluster) IndexStats(r IndexStatsRequest) (response IndexStatsResponse, err error) {
+	err = c.Execute(r, &response)
+	return
+}
+
+func (c *Cluster) GetSettings(r GetSettingsRequest) (response GetSettingsResponse, err error) {
+	err = c.Execute(r, &response)
+	return
+}
+
+func (c *Cluster) UpdateSettings(r UpdateSettingsRequest) (response AcknowledgedResponse, err error) {
+	err = c.Execute(r, &response)
+	return
+}
+
+// OpenIndex opens a closed index, and returns whether that was acknowledged.
+func (c *Cluster) OpenIndex(r OpenIndexRequest) (bool, error) {
+	return c.acknowledged(r)
+}
+
+// CloseIndex closes an open index, and returns whether that was acknowledged.
+func (c *Cluster) CloseIndex(r CloseIndexRequest) (bool, error) {
+	return c.acknowledged(r)
+}
+
+func (c *Cluster) acknowledged(f Fireable) (bool, error) {
+	var response AcknowledgedResponse
+	if err := c.Execute(f, &response); err != nil {
+		return false, err
+	}
+	if response.Error != "" {
+		return false, fmt.Errorf("%s (status %d)", response.Error, response.Status)
+	}
+	return response.Acknowledged, nil
 }
 
 // Shutdown terminates the Cluster's event dispatcher.
@@ -234,11 +234,11 @@ func TestSimpleTermQuery(t *testing.T) {
 	}))
 
 	request := es.SearchRequest{
-		es.SearchParams{
+		Params: es.SearchParams{
 			Indices: []string{"twitter"},
 			Types:   []string{"tweet"},
 		},
-		q,
+		Query: q,
 	}
 
 	response, err := c.Search(request)
@@ -288,25 +288,25 @@ func TestMultiSearch(t *testing.T) {
 	request := es.MultiSearchRequest{
 		Requests: []es.SearchRequest{
 			es.SearchRequest{
-				es.SearchParams{
+				Params: es.SearchParams{
 					Indices: []string{"index1"},
 					Types:   []string{"foo"},
 				},
-				q1,
+				Query: q1,
 			},
 			es.SearchRequest{
-				es.SearchParams{
+				Params: es.SearchParams{
 					Indices: []string{"index2"},
 					Types:   []string{"bar"},
 				},
-				q2,
+				Query: q2,
 			},
 			es.SearchRequest{
-				es.SearchParams{
-					Indices: []string{}, // "index1", "index2" is not supported (!)
-					Types:   []string{}, // "type1", "type2" is not supported (!)
+				Params: es.SearchParams{
+					Indices: []string{"index1", "index2"},
+					Types:   []string{"foo", "bar"},
 				},
-				q3,
+				Query: q3,
 			},
 		},
 	}
@@ -383,11 +383,11 @@ func TestConstantScoreNoScore(t *testing.T) {
 	}
 
 	request := es.SearchRequest{
-		es.SearchParams{
+		Params: es.SearchParams{
 			Indices: []string{"twitter"},
 			Types:   []string{"tweet"},
 		},
-		q,
+		Query: q,
 	}
 
 	response, err := c.Search(request)
@@ -0,0 +1,393 @@
+package elasticsearch
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// FakeClient is an in-memory Client, for testing code which depends on this
+// package without a running ElasticSearch. It's not a query engine: it only
+// understands match_all and term queries, which it evaluates against the
+// top-level fields of the indexed documents. Other queries, and any other part
+// of a search body besides the query, size and from, return an error. Unlike
+// ElasticSearch, a search without a size returns every matching hit.
+type FakeClient struct {
+	sync.Mutex
+	documents map[fakeKey]*fakeDocument
+	lastId    int
+}
+
+var _ Client = (*FakeClient)(nil)
+
+type fakeKey struct {
+	index, typ, id string
+}
+
+type fakeDocument struct {
+	version int
+	source  json.RawMessage
+}
+
+// NewFakeClient returns an empty FakeClient.
+func NewFakeClient() *FakeClient {
+	return &FakeClient{
+		documents: map[fakeKey]*fakeDocument{},
+	}
+}
+
+func (c *FakeClient) Index(r IndexRequest) (IndexResponse, error) {
+	c.Lock()
+	defer c.Unlock()
+	return c.index(r.Params, r.Source, false)
+}
+
+func (c *FakeClient) Create(r CreateRequest) (IndexResponse, error) {
+	c.Lock()
+	defer c.Unlock()
+	return c.index(r.Params, r.Source, true)
+}
+
+// Update supports partial documents and upserts, but not scripts.
+func (c *FakeClient) Update(r UpdateRequest) (IndexResponse, error) {
+	c.Lock()
+	defer c.Unlock()
+	return c.update(r.Params, r.Source)
+}
+
+func (c *FakeClient) Delete(r DeleteRequest) (IndexResponse, error) {
+	c.Lock()
+	defer c.Unlock()
+	return c.delete(r.Params)
+}
+
+func (c *FakeClient) Bulk(r BulkRequest) (BulkResponse, error) {
+	c.Lock()
+	defer c.Unlock()
+
+	response := BulkResponse{}
+	for _, req := range r.Requests {
+		var (
+			item IndexResponse
+			err  error
+		)
+		switch req := req.(type) {
+		case IndexRequest:
+			item, err = c.index(req.Params, req.Source, false)
+		case CreateRequest:
+			item, err = c.index(req.Params, req.Source, true)
+		case UpdateRequest:
+			item, err = c.update(req.Params, req.Source)
+		case DeleteRequest:
+			item, err = c.delete(req.Params)
+		default:
+			err = fmt.Errorf("fake client: unsupported bulk request %T", req)
+		}
+		if err != nil {
+			return BulkResponse{}, err
+		}
+		response.Items = append(response.Items, BulkItemResponse(item))
+	}
+	return response, nil
+}
+
+func (c *FakeClient) Search(r SearchRequest) (SearchResponse, error) {
+	match, from, size, err := fakeMatcher(r)
+	if err != nil {
+		return SearchResponse{}, err
+	}
+
+	c.Lock()
+	defer c.Unlock()
+
+	keys := []fakeKey{}
+	for key := range c.documents {
+		if fakeScoped(r.Params.Indices, key.index) && fakeScoped(r.Params.Types, key.typ) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Sort(fakeKeys(keys))
+
+	response := SearchResponse{}
+	for _, key := range keys {
+		doc := c.documents[key]
+		var fields map[string]interface{}
+		if err := json.Unmarshal(doc.source, &fields); err != nil {
+			continue // not an object, so no fields to match
+		}
+		if !match(fields) {
+			continue
+		}
+		score := 1.0
+		response.HitsWrapper.Hits = append(response.HitsWrapper.Hits, Hit{
+			Index:  key.index,
+			Type:   key.typ,
+			ID:     key.id,
+			Score:  &score,
+			Source: doc.source,
+		})
+	}
+	response.HitsWrapper.Total = len(response.HitsWrapper.Hits)
+	response.HitsWrapper.TotalRelation = "eq"
+
+	hits := response.HitsWrapper.Hits
+	if from > len(hits) {
+		from = len(hits)
+	}
+	hits = hits[from:]
+	if size >= 0 && size < len(hits) {
+		hits = hits[:size]
+	}
+	response.HitsWrapper.Hits = hits
+	return response, nil
+}
+
+func (c *FakeClient) MultiSearch(r MultiSearchRequest) (MultiSearchResponse, error) {
+	response := MultiSearchResponse{}
+	for _, req := range r.Requests {
+		searchResponse, err := c.Search(req)
+		if err != nil {
+			return MultiSearchResponse{}, err
+		}
+		response.Responses = append(response.Responses, searchResponse)
+	}
+	return response, nil
+}
+
+func (c *FakeClient) index(p IndexParams, source interface{}, create bool) (IndexResponse, error) {
+	if err := p.validate(create); err != nil {
+		return IndexResponse{}, err
+	}
+
+	if p.Id == "" {
+		c.lastId++
+		p.Id = strconv.Itoa(c.lastId)
+	}
+
+	buf, err := json.Marshal(source)
+	if err != nil {
+		return IndexResponse{}, err
+	}
+
+	key := fakeKey{p.Index, p.Type, p.Id}
+	doc, ok := c.documents[key]
+	if ok && create {
+		return fakeResponse(key, doc.version, "document already exists", 409), nil
+	}
+	if !ok {
+		doc = &fakeDocument{}
+		c.documents[key] = doc
+	}
+
+	doc.version++
+	doc.source = buf
+	return fakeResponse(key, doc.version, "", 0), nil
+}
+
+func (c *FakeClient) update(p IndexParams, source interface{}) (IndexResponse, error) {
+	if err := p.validate(true); err != nil {
+		return IndexResponse{}, err
+	}
+
+	body, err := updateBody(source)
+	if err != nil {
+		return IndexResponse{}, err
+	}
+	buf, err := json.Marshal(body)
+	if err != nil {
+		return IndexResponse{}, err
+	}
+
+	var u struct {
+		Doc         map[string]json.RawMessage `json:"doc"`
+		DocAsUpsert bool                       `json:"doc_as_upsert"`
+		Script      json.RawMessage            `json:"script"`
+		Upsert      json.RawMessage            `json:"upsert"`
+	}
+	if err := json.Unmarshal(buf, &u); err != nil {
+		return IndexResponse{}, err
+	}
+	if u.Script != nil {
+		return IndexResponse{}, fmt.Errorf("fake client: scripted updates are not supported")
+	}
+
+	key := fakeKey{p.Index, p.Type, p.Id}
+	doc, ok := c.documents[key]
+	switch {
+	case !ok && u.DocAsUpsert:
+		return c.index(p, u.Doc, false)
+	case !ok && u.Upsert != nil:
+		return c.index(p, u.Upsert, false)
+	case !ok:
+		return fakeResponse(key, 0, "document missing", 404), nil
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(doc.source, &fields); err != nil {
+		return IndexResponse{}, err
+	}
+	if fields == nil {
+		fields = map[string]json.RawMessage{} // the document was null
+	}
+	for field, value := range u.Doc {
+		fields[field] = value
+	}
+	if doc.source, err = json.Marshal(fields); err != nil {
+		return IndexResponse{}, err
+	}
+
+	doc.version++
+	return fakeResponse(key, doc.version, "", 0), nil
+}
+
+func (c *FakeClient) delete(p IndexParams) (IndexResponse, error) {
+	if err := p.validate(true); err != nil {
+		return IndexResponse{}, err
+	}
+
+	key := fakeKey{p.Index, p.Type, p.Id}
+	doc, ok := c.documents[key]
+	if !ok {
+		return fakeResponse(key, 0, "", 404), nil
+	}
+
+	delete(c.documents, key)
+	return fakeResponse(key, doc.version+1, "", 0), nil
+}
+
+func fakeResponse(key fakeKey, version int, err string, status int) IndexResponse {
+	return IndexResponse{
+		Found:   status != 404,
+		ID:      key.id,
+		Index:   key.index,
+		OK:      err == "" && status == 0,
+		Type:    key.typ,
+		Version: version,
+		Error:   err,
+		Status:  status,
+	}
+}
+
+// fakeMatcher returns a function which reports whether a document's fields
+// match the query of the SearchRequest, and the from and size of the page of
+// hits to return. A size of -1 means all of them.
+func fakeMatcher(r SearchRequest) (match func(map[string]interface{}) bool, from, size int, err error) {
+	match, size = func(map[string]interface{}) bool { return true }, -1
+
+	body, err := r.body()
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	if body == nil {
+		return match, from, size, nil
+	}
+
+	top, err := objectFields(body)
+	if err != nil {
+		return nil, 0, 0, fmt.Errorf("fake client: %s", err)
+	}
+	for key, raw := range top {
+		switch key {
+		case "query":
+		case "from":
+			err = fakeCount(raw, &from)
+		case "size":
+			err = fakeCount(raw, &size)
+		default:
+			err = fmt.Errorf("%q is not supported", key)
+		}
+		if err != nil {
+			return nil, 0, 0, fmt.Errorf("fake client: %s", err)
+		}
+	}
+
+	var query map[string]json.RawMessage
+	if raw, ok := top["query"]; ok {
+		if err := json.Unmarshal(raw, &query); err != nil {
+			return nil, 0, 0, fmt.Errorf("fake client: query: %s", err)
+		}
+	}
+
+	if _, ok := query["match_all"]; ok || len(query) == 0 {
+		return match, from, size, nil
+	}
+
+	term, ok := query["term"]
+	if !ok || len(query) != 1 {
+		return nil, 0, 0, fmt.Errorf("fake client: only match_all and term queries are supported")
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(term, &fields); err != nil || len(fields) != 1 {
+		return nil, 0, 0, fmt.Errorf("fake client: term query must have exactly one field")
+	}
+
+	for field, raw := range fields {
+		var boosted struct {
+			Value json.RawMessage `json:"value"`
+		}
+		if err := json.Unmarshal(raw, &boosted); err == nil && boosted.Value != nil {
+			raw = boosted.Value
+		}
+
+		var value interface{}
+		if err := json.Unmarshal(raw, &value); err != nil {
+			return nil, 0, 0, fmt.Errorf("fake client: term query: %s", err)
+		}
+
+		return func(doc map[string]interface{}) bool {
+			if values, ok := doc[field].([]interface{}); ok {
+				for _, v := range values {
+					if reflect.DeepEqual(v, value) {
+						return true
+					}
+				}
+				return false
+			}
+			return reflect.DeepEqual(doc[field], value)
+		}, from, size, nil
+	}
+	panic("unreachable")
+}
+
+// fakeCount decodes the raw value of a from or size, which mustn't be negative.
+func fakeCount(raw json.RawMessage, n *int) error {
+	if err := json.Unmarshal(raw, n); err != nil {
+		return err
+	}
+	if *n < 0 {
+		return fmt.Errorf("%d is negative", *n)
+	}
+	return nil
+}
+
+// fakeScoped reports whether the name is within scope, ie. scope is empty or
+// contains the name.
+func fakeScoped(scope []string, name string) bool {
+	if len(scope) <= 0 {
+		return true
+	}
+	for _, s := range scope {
+		if s == name || s == "_all" {
+			return true
+		}
+	}
+	return false
+}
+
+type fakeKeys []fakeKey
+
+func (a fakeKeys) Len() int      { return len(a) }
+func (a fakeKeys) Swap(i, j int) { a[i], a[j] = a[j], a[i] }
+func (a fakeKeys) Less(i, j int) bool {
+	if a[i].index != a[j].index {
+		return a[i].index < a[j].index
+	}
+	if a[i].typ != a[j].typ {
+		return a[i].typ < a[j].typ
+	}
+	return a[i].id < a[j].id
+}
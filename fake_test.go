@@ -0,0 +1,208 @@
+package elasticsearch_test
+
+import (
+	"encoding/json"
+	es "github.com/peterbourgon/elasticsearch"
+	"testing"
+)
+
+func TestFakeClientIndexThenSearch(t *testing.T) {
+	c := es.NewFakeClient()
+
+	for id, user := range map[string]string{"1": "kimchy", "2": "bob", "3": "kimchy"} {
+		if _, err := c.Index(es.IndexRequest{
+			Params: es.IndexParams{Index: "twitter", Type: "tweet", Id: id},
+			Source: map[string]string{"user": user},
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	response, err := c.Search(es.SearchRequest{
+		Params: es.SearchParams{Indices: []string{"twitter"}},
+		Query:  es.QueryWrapper(es.FieldTerm("user", "kimchy")),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expected, got := 2, response.HitsWrapper.Total; expected != got {
+		t.Fatalf("expected %d hit(s); got %d", expected, got)
+	}
+
+	for i, expected := range []string{"1", "3"} {
+		hit := response.HitsWrapper.Hits[i]
+		if got := hit.ID; expected != got {
+			t.Errorf("hit %d: expected id = %q; got %q", i, expected, got)
+		}
+
+		var doc struct {
+			User string `json:"user"`
+		}
+		if err := json.Unmarshal(hit.Source, &doc); err != nil {
+			t.Fatal(err)
+		}
+		if expected, got := "kimchy", doc.User; expected != got {
+			t.Errorf("hit %d: expected user = %q; got %q", i, expected, got)
+		}
+	}
+}
+
+func TestFakeClientMatchAll(t *testing.T) {
+	c := es.NewFakeClient()
+
+	if _, err := c.Bulk(es.BulkRequest{
+		Requests: []es.BulkIndexable{
+			es.IndexRequest{es.IndexParams{Index: "index1", Type: "foo", Id: "1"}, map[string]string{"user": "alice"}},
+			es.IndexRequest{es.IndexParams{Index: "index2", Type: "bar", Id: "2"}, map[string]string{"user": "bob"}},
+			es.CreateRequest{es.IndexParams{Index: "index2", Type: "bar", Id: "3"}, map[string]string{"user": "carol"}},
+			es.DeleteRequest{es.IndexParams{Index: "index2", Type: "bar", Id: "3"}},
+			es.UpdateRequest{es.IndexParams{Index: "index1", Type: "foo", Id: "1"}, es.UpdateSource{Doc: map[string]string{"user": "dave"}}},
+		},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tuple := range []struct {
+		r        es.SearchRequest
+		expected int
+	}{
+		{es.SearchRequest{Query: es.QueryWrapper(es.MatchAllQuery())}, 2},
+		{es.SearchRequest{}, 2},
+		{es.SearchRequest{Params: es.SearchParams{Indices: []string{"index1"}}}, 1},
+		{es.SearchRequest{Params: es.SearchParams{Types: []string{"bar"}}}, 1},
+		{es.SearchRequest{Params: es.SearchParams{Indices: []string{"index3"}}}, 0},
+	} {
+		response, err := c.Search(tuple.r)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if expected, got := tuple.expected, response.HitsWrapper.Total; expected != got {
+			t.Errorf("%+v: expected %d hit(s); got %d", tuple.r.Params, expected, got)
+		}
+	}
+}
+
+func TestFakeClientWrites(t *testing.T) {
+	c := es.NewFakeClient()
+	p := es.IndexParams{Index: "twitter", Type: "tweet", Id: "1"}
+
+	if response, err := c.Create(es.CreateRequest{p, map[string]string{"user": "kimchy"}}); err != nil {
+		t.Fatal(err)
+	} else if expected, got := 1, response.Version; expected != got {
+		t.Errorf("create: expected version = %d; got %d", expected, got)
+	}
+
+	if response, err := c.Create(es.CreateRequest{p, map[string]string{"user": "kimchy"}}); err != nil {
+		t.Fatal(err)
+	} else if response.Error == "" {
+		t.Errorf("second create: expected error, got none")
+	}
+
+	if response, err := c.Update(es.UpdateRequest{p, es.UpdateSource{Doc: map[string]string{"user": "bob"}}}); err != nil {
+		t.Fatal(err)
+	} else if expected, got := 2, response.Version; expected != got {
+		t.Errorf("update: expected version = %d; got %d", expected, got)
+	}
+
+	response, err := c.Search(es.SearchRequest{Query: es.QueryWrapper(es.FieldTerm("user", "bob"))})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected, got := 1, response.HitsWrapper.Total; expected != got {
+		t.Errorf("search after update: expected %d hit(s); got %d", expected, got)
+	}
+
+	if response, err := c.Delete(es.DeleteRequest{p}); err != nil {
+		t.Fatal(err)
+	} else if !response.Found {
+		t.Errorf("delete: expected found = true")
+	}
+
+	if response, err := c.Delete(es.DeleteRequest{p}); err != nil {
+		t.Fatal(err)
+	} else if response.Found {
+		t.Errorf("second delete: expected found = false")
+	}
+
+	if _, err := c.Search(es.SearchRequest{Query: es.QueryWrapper(es.FieldMatch("user", "bob"))}); err == nil {
+		t.Errorf("match query: expected unsupported error, got none")
+	}
+}
+
+func TestFakeClientFromSize(t *testing.T) {
+	c := es.NewFakeClient()
+	for _, id := range []string{"1", "2", "3"} {
+		p := es.IndexParams{Index: "twitter", Type: "tweet", Id: id}
+		if _, err := c.Index(es.IndexRequest{p, map[string]string{"user": "kimchy"}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	response, err := c.Search(es.SearchRequest{Query: map[string]interface{}{"from": 1, "size": 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected, got := 3, response.HitsWrapper.Total; expected != got {
+		t.Errorf("expected total = %d; got %d", expected, got)
+	}
+	if expected, got := 1, len(response.HitsWrapper.Hits); expected != got {
+		t.Fatalf("expected %d hit(s); got %d", expected, got)
+	}
+	if expected, got := "2", response.HitsWrapper.Hits[0].ID; expected != got {
+		t.Errorf("expected hit _id = %q; got %q", expected, got)
+	}
+
+	response, err = c.Search(es.SearchRequest{Query: map[string]interface{}{"from": 5}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected, got := 0, len(response.HitsWrapper.Hits); expected != got {
+		t.Errorf("expected %d hit(s) past the end; got %d", expected, got)
+	}
+
+	if _, err := c.Search(es.SearchRequest{Query: map[string]interface{}{"size": -1}}); err == nil {
+		t.Errorf("negative size: expected error, got none")
+	}
+}
+
+func TestFakeClientUpdateNullDocument(t *testing.T) {
+	c := es.NewFakeClient()
+	p := es.IndexParams{Index: "twitter", Type: "tweet", Id: "1"}
+	if _, err := c.Index(es.IndexRequest{p, nil}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := c.Update(es.UpdateRequest{p, es.UpdateSource{Doc: map[string]string{"user": "bob"}}}); err != nil {
+		t.Fatal(err)
+	}
+
+	response, err := c.Search(es.SearchRequest{Query: es.QueryWrapper(es.FieldTerm("user", "bob"))})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected, got := 1, response.HitsWrapper.Total; expected != got {
+		t.Errorf("expected %d hit(s) after updating a null document; got %d", expected, got)
+	}
+}
+
+func TestFakeClientUnsupportedBody(t *testing.T) {
+	c := es.NewFakeClient()
+	p := es.IndexParams{Index: "twitter", Type: "tweet", Id: "1"}
+	if _, err := c.Index(es.IndexRequest{p, map[string]string{"user": "alice"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	// A term query which wasn't wrapped with QueryWrapper.
+	if _, err := c.Search(es.SearchRequest{Query: es.FieldTerm("user", "bob")}); err == nil {
+		t.Errorf("unwrapped query: expected unsupported error, got none")
+	}
+
+	if _, err := c.Search(es.SearchRequest{
+		Query:      es.QueryWrapper(es.MatchAllQuery()),
+		PostFilter: es.TermFilter(es.TermFilterParams{Field: "user", Value: "bob"}),
+	}); err == nil {
+		t.Errorf("post_filter: expected unsupported error, got none")
+	}
+}
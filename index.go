@@ -6,7 +6,7 @@ import (
 	"fmt"
 	"net/http"
 	"net/url"
-	"path"
+	"strings"
 )
 
 type BulkResponse struct {
@@ -18,13 +18,15 @@ type BulkResponse struct {
 type BulkItemResponse IndexResponse
 
 // Bulk responses are wrapped in an extra object whose only key is the
-// operation performed (create, delete, or index). BulkItemResponse response is
-// an alias for IndexResponse, but deals with this extra indirection.
+// operation performed (create, delete, index, or update). BulkItemResponse
+// response is an alias for IndexResponse, but deals with this extra
+// indirection.
 func (r *BulkItemResponse) UnmarshalJSON(data []byte) error {
 	var wrapper struct {
 		Create json.RawMessage `json:"create"`
 		Delete json.RawMessage `json:"delete"`
 		Index  json.RawMessage `json:"index"`
+		Update json.RawMessage `json:"update"`
 	}
 
 	if err := json.Unmarshal(data, &wrapper); err != nil {
@@ -40,8 +42,10 @@ func (r *BulkItemResponse) UnmarshalJSON(data []byte) error {
 		inner = wrapper.Index
 	case wrapper.Delete != nil:
 		inner = wrapper.Delete
+	case wrapper.Update != nil:
+		inner = wrapper.Update
 	default:
-		return fmt.Errorf("expected bulk response to be create, index, or delete")
+		return fmt.Errorf("expected bulk response to be create, index, delete, or update")
 	}
 
 	if err := json.Unmarshal(inner, (*IndexResponse)(r)); err != nil {
@@ -64,6 +68,22 @@ type IndexResponse struct {
 	TimedOut bool   `json:"timed_out,omitempty"`
 }
 
+// Refresh policies, for IndexParams and BulkParams. Only these values, or an
+// empty string for ElasticSearch's default, are accepted.
+const (
+	RefreshTrue    = "true"
+	RefreshFalse   = "false"
+	RefreshWaitFor = "wait_for"
+)
+
+func validateRefresh(refresh string) error {
+	switch refresh {
+	case "", RefreshTrue, RefreshFalse, RefreshWaitFor:
+		return nil
+	}
+	return fmt.Errorf("invalid refresh policy %q", refresh)
+}
+
 type IndexParams struct {
 	Index string `json:"_index"`
 	Type  string `json:"_type"`
@@ -79,11 +99,22 @@ type IndexParams struct {
 	Timestamp   string `json:"_timestamp,omitempty"`
 	Version     string `json:"_version,omitempty"`
 	VersionType string `json:"_version_type,omitempty"`
+
+	// RetryOnConflict only applies to updates.
+	RetryOnConflict string `json:"_retry_on_conflict,omitempty"`
+
+	// OpType "create" makes an IndexRequest fail if the document exists. In
+	// a bulk request, use a CreateRequest instead.
+	OpType string `json:"-"`
+
+	// Fields selects stored fields to return, for requests that support it.
+	Fields []string `json:"-"`
 }
 
 func (p IndexParams) Values() url.Values {
 	return values(map[string]string{
 		"consistency":  p.Consistency,
+		"op_type":      p.OpType,
 		"parent":       p.Parent,
 		"percolate":    p.Percolate,
 		"refresh":      p.Refresh,
@@ -93,17 +124,184 @@ func (p IndexParams) Values() url.Values {
 		"timestamp":    p.Timestamp,
 		"version":      p.Version,
 		"version_type": p.VersionType,
+		"fields":       strings.Join(p.Fields, ","),
 	})
 }
 
+// validate returns an error if the params don't identify a document, or are
+// otherwise invalid. Id is optional in some requests, eg. IndexRequest, which
+// lets ElasticSearch generate one.
+func (p IndexParams) validate(idRequired bool) error {
+	switch {
+	case p.Index == "":
+		return fmt.Errorf("no index specified")
+	case p.Type == "":
+		return fmt.Errorf("no type specified")
+	case idRequired && p.Id == "":
+		return fmt.Errorf("no id specified")
+	}
+	return validateRefresh(p.Refresh)
+}
+
+// bulkMetadata is the subset of IndexParams which applies to a single action
+// in a bulk request. Request-wide settings, like Refresh, belong in BulkParams.
+type bulkMetadata struct {
+	Index       string `json:"_index"`
+	Type        string `json:"_type"`
+	Id          string `json:"_id"`
+	Parent      string `json:"_parent,omitempty"`
+	Routing     string `json:"_routing,omitempty"`
+	TTL         string `json:"_ttl,omitempty"`
+	Timestamp   string `json:"_timestamp,omitempty"`
+	Version     string `json:"_version,omitempty"`
+	VersionType string `json:"_version_type,omitempty"`
+
+	RetryOnConflict string `json:"_retry_on_conflict,omitempty"` // update only
+}
+
+func (p IndexParams) bulkMetadata() bulkMetadata {
+	return bulkMetadata{
+		Index:       p.Index,
+		Type:        p.Type,
+		Id:          p.Id,
+		Parent:      p.Parent,
+		Routing:     p.Routing,
+		TTL:         p.TTL,
+		Timestamp:   p.Timestamp,
+		Version:     p.Version,
+		VersionType: p.VersionType,
+	}
+}
+
+// setPath points the URI at the document, eg. /index/type/id, followed by the
+// endpoint, if any. Empty segments are dropped. Each segment is escaped, so
+// that an id like "http://x/y" remains a single segment.
+func (p IndexParams) setPath(uri *url.URL, endpoint ...string) {
+	raw, escaped := []string{""}, []string{""}
+	for _, segment := range append([]string{p.Index, p.Type, p.Id}, endpoint...) {
+		if segment == "" {
+			continue
+		}
+		raw = append(raw, segment)
+		escaped = append(escaped, url.PathEscape(segment))
+	}
+	uri.Path = strings.Join(raw, "/")
+	uri.RawPath = strings.Join(escaped, "/")
+}
+
+// http://www.elasticsearch.org/guide/reference/api/get/
+// SourceEnabled is a pointer, so that the _source is fetched by default; set
+// it to false to fetch only the document's metadata, eg. to check existence.
+type GetRequest struct {
+	Params        IndexParams
+	SourceEnabled *bool
+}
+
+func (r GetRequest) Request(uri *url.URL) (*http.Request, error) {
+	if err := r.Params.validate(true); err != nil {
+		return nil, err
+	}
+
+	r.Params.setPath(uri)
+	query := r.Params.Values()
+	if r.SourceEnabled != nil && !*r.SourceEnabled {
+		query.Set("_source", "false")
+	}
+	uri.RawQuery = query.Encode()
+
+	return http.NewRequest("GET", uri.String(), nil)
+}
+
+type GetResponse struct {
+	Found   bool   `json:"found"`
+	ID      string `json:"_id"`
+	Index   string `json:"_index"`
+	Type    string `json:"_type"`
+	Version int    `json:"_version"`
+
+	Source json.RawMessage            `json:"_source,omitempty"`
+	Fields map[string]json.RawMessage `json:"fields,omitempty"`
+
+	Error  string `json:"error,omitempty"`
+	Status int    `json:"status,omitempty"`
+}
+
+// UnmarshalJSON accepts the error as either a string, or an object.
+func (r *GetResponse) UnmarshalJSON(data []byte) error {
+	type response GetResponse // without this method, to avoid recursion
+	return unmarshalWithError(data, (*response)(r), &r.Error)
+}
+
+// http://www.elasticsearch.org/guide/reference/api/termvectors/
+// No Fields means all fields which store term vectors.
+type TermVectorsRequest struct {
+	Index  string
+	Type   string
+	Id     string
+	Fields []string
+}
+
+func (r TermVectorsRequest) Request(uri *url.URL) (*http.Request, error) {
+	p := IndexParams{Index: r.Index, Type: r.Type, Id: r.Id, Fields: r.Fields}
+	if err := p.validate(true); err != nil {
+		return nil, err
+	}
+
+	p.setPath(uri, "_termvectors")
+	uri.RawQuery = p.Values().Encode()
+
+	return http.NewRequest("GET", uri.String(), nil)
+}
+
+type TermVectorsResponse struct {
+	Found       bool                        `json:"found"`
+	ID          string                      `json:"_id"`
+	Index       string                      `json:"_index"`
+	Type        string                      `json:"_type"`
+	Version     int                         `json:"_version"`
+	TermVectors map[string]FieldTermVectors `json:"term_vectors"`
+
+	Error  string `json:"error,omitempty"`
+	Status int    `json:"status,omitempty"`
+}
+
+// UnmarshalJSON accepts the error as either a string, or an object.
+func (r *TermVectorsResponse) UnmarshalJSON(data []byte) error {
+	type response TermVectorsResponse // without this method, to avoid recursion
+	return unmarshalWithError(data, (*response)(r), &r.Error)
+}
+
+// FieldTermVectors are the term vectors of a single field, keyed by term.
+type FieldTermVectors struct {
+	FieldStatistics struct {
+		SumDocFreq int64 `json:"sum_doc_freq"`
+		DocCount   int64 `json:"doc_count"`
+		SumTTF     int64 `json:"sum_ttf"`
+	} `json:"field_statistics"`
+	Terms map[string]TermStatistics `json:"terms"`
+}
+
+// TermStatistics describe one term of a field. DocFreq and TTF (total term
+// frequency) are only returned if term statistics are requested.
+type TermStatistics struct {
+	TermFreq int   `json:"term_freq"`
+	DocFreq  int64 `json:"doc_freq,omitempty"`
+	TTF      int64 `json:"ttf,omitempty"`
+	Tokens   []struct {
+		Position    int `json:"position"`
+		StartOffset int `json:"start_offset"`
+		EndOffset   int `json:"end_offset"`
+	} `json:"tokens,omitempty"`
+}
+
 type IndexRequest struct {
 	Params IndexParams
 	Source interface{}
 }
 
 func (r IndexRequest) EncodeBulkHeader(enc *json.Encoder) error {
-	return enc.Encode(map[string]IndexParams{
-		"index": r.Params,
+	return enc.Encode(map[string]bulkMetadata{
+		"index": r.Params.bulkMetadata(),
 	})
 }
 
@@ -111,8 +309,14 @@ func (r IndexRequest) EncodeSource(enc *json.Encoder) error {
 	return enc.Encode(r.Source)
 }
 
+// Request builds a PUT to the document's path. If no Id is given, it builds a
+// POST to the type instead, and ElasticSearch generates the Id.
 func (r IndexRequest) Request(uri *url.URL) (*http.Request, error) {
-	uri.Path = path.Join("/", r.Params.Index, r.Params.Type, r.Params.Id)
+	if err := r.Params.validate(false); err != nil {
+		return nil, err
+	}
+
+	r.Params.setPath(uri)
 	uri.RawQuery = r.Params.Values().Encode()
 
 	buf := new(bytes.Buffer)
@@ -122,7 +326,12 @@ func (r IndexRequest) Request(uri *url.URL) (*http.Request, error) {
 		return nil, err
 	}
 
-	return http.NewRequest("PUT", uri.String(), buf)
+	method := "PUT"
+	if r.Params.Id == "" {
+		method = "POST"
+	}
+
+	return newRequest(method, uri.String(), contentTypeJSON, buf)
 }
 
 type CreateRequest struct {
@@ -131,8 +340,8 @@ type CreateRequest struct {
 }
 
 func (r CreateRequest) EncodeBulkHeader(enc *json.Encoder) error {
-	return enc.Encode(map[string]IndexParams{
-		"create": r.Params,
+	return enc.Encode(map[string]bulkMetadata{
+		"create": r.Params.bulkMetadata(),
 	})
 }
 
@@ -141,7 +350,11 @@ func (r CreateRequest) EncodeSource(enc *json.Encoder) error {
 }
 
 func (r CreateRequest) Request(uri *url.URL) (*http.Request, error) {
-	uri.Path = path.Join("/", r.Params.Index, r.Params.Type, r.Params.Id, "_create")
+	if err := r.Params.validate(true); err != nil {
+		return nil, err
+	}
+
+	r.Params.setPath(uri, "_create")
 	uri.RawQuery = r.Params.Values().Encode()
 
 	buf := new(bytes.Buffer)
@@ -151,7 +364,7 @@ func (r CreateRequest) Request(uri *url.URL) (*http.Request, error) {
 		return nil, err
 	}
 
-	return http.NewRequest("PUT", uri.String(), buf)
+	return newRequest("PUT", uri.String(), contentTypeJSON, buf)
 }
 
 type DeleteRequest struct {
@@ -159,8 +372,8 @@ type DeleteRequest struct {
 }
 
 func (r DeleteRequest) EncodeBulkHeader(enc *json.Encoder) error {
-	return enc.Encode(map[string]IndexParams{
-		"delete": r.Params,
+	return enc.Encode(map[string]bulkMetadata{
+		"delete": r.Params.bulkMetadata(),
 	})
 }
 
@@ -169,28 +382,108 @@ func (r DeleteRequest) EncodeSource(enc *json.Encoder) error {
 }
 
 func (r DeleteRequest) Request(uri *url.URL) (*http.Request, error) {
-	uri.Path = path.Join("/", r.Params.Index, r.Params.Type, r.Params.Id)
+	if err := r.Params.validate(true); err != nil {
+		return nil, err
+	}
+
+	r.Params.setPath(uri)
 	uri.RawQuery = r.Params.Values().Encode()
 
 	return http.NewRequest("DELETE", uri.String(), nil)
 }
 
+// UpdateRequest's Source is the body of the update. UpdateSource covers the
+// common shapes; a map or struct with a "doc" or "script" key, etc., is sent
+// as-is. Any other Source is taken to be a partial document, and sent as
+// `{"doc":...}`.
 type UpdateRequest struct {
 	Params IndexParams
 	Source interface{}
 }
 
+// UpdateSource is a typed Source for an UpdateRequest. Set either Doc, to
+// merge a partial document, or Script. Upsert is indexed if the document
+// doesn't exist yet; DocAsUpsert and ScriptedUpsert use the Doc or Script
+// to create it instead.
+type UpdateSource struct {
+	Doc            interface{} `json:"doc,omitempty"`
+	DocAsUpsert    bool        `json:"doc_as_upsert,omitempty"`
+	Script         string      `json:"script,omitempty"`
+	ScriptedUpsert bool        `json:"scripted_upsert,omitempty"`
+	Upsert         interface{} `json:"upsert,omitempty"`
+}
+
+func (r UpdateRequest) EncodeBulkHeader(enc *json.Encoder) error {
+	metadata := r.Params.bulkMetadata()
+	metadata.RetryOnConflict = r.Params.RetryOnConflict
+	return enc.Encode(map[string]bulkMetadata{
+		"update": metadata,
+	})
+}
+
+// EncodeSource writes the update body, eg. `{"doc":{...}}`. It's the same in
+// a bulk request as in a single update.
+func (r UpdateRequest) EncodeSource(enc *json.Encoder) error {
+	body, err := updateBody(r.Source)
+	if err != nil {
+		return err
+	}
+	return enc.Encode(body)
+}
+
+// updateKeys are the top-level keys of an update body.
+var updateKeys = map[string]bool{
+	"doc":             true,
+	"doc_as_upsert":   true,
+	"detect_noop":     true,
+	"script":          true,
+	"scripted_upsert": true,
+	"upsert":          true,
+	"lang":            true,
+	"params":          true,
+	"_source":         true,
+}
+
+// updateBody returns the update body for the Source of an UpdateRequest: the
+// Source itself if it's already an update body, or else `{"doc":source}`.
+func updateBody(source interface{}) (interface{}, error) {
+	switch source.(type) {
+	case nil, UpdateSource, *UpdateSource:
+		return source, nil
+	}
+
+	fields, err := objectFields(source)
+	if err != nil {
+		return nil, fmt.Errorf("update source: %s", err)
+	}
+	for key := range fields {
+		if updateKeys[key] {
+			return source, nil
+		}
+	}
+	return UpdateSource{Doc: source}, nil
+}
+
 func (r UpdateRequest) Request(uri *url.URL) (*http.Request, error) {
-	uri.Path = path.Join("/", r.Params.Index, r.Params.Type, r.Params.Id, "_update")
-	uri.RawQuery = r.Params.Values().Encode()
+	if err := r.Params.validate(true); err != nil {
+		return nil, err
+	}
+
+	r.Params.setPath(uri, "_update")
+	query := r.Params.Values()
+	if r.Params.RetryOnConflict != "" {
+		query.Set("retry_on_conflict", r.Params.RetryOnConflict)
+	}
+	uri.RawQuery = query.Encode()
 
 	buf := new(bytes.Buffer)
+	enc := json.NewEncoder(buf)
 
-	if err := json.NewEncoder(buf).Encode(r.Source); err != nil {
+	if err := r.EncodeSource(enc); err != nil {
 		return nil, err
 	}
 
-	return http.NewRequest("POST", uri.String(), buf)
+	return newRequest("POST", uri.String(), contentTypeJSON, buf)
 }
 
 //
@@ -203,6 +496,11 @@ type BulkParams struct {
 	Replication string
 }
 
+// Validate returns an error if the params would produce an invalid request.
+func (p BulkParams) Validate() error {
+	return validateRefresh(p.Refresh)
+}
+
 func (p BulkParams) Values() url.Values {
 	return values(map[string]string{
 		"consistency": p.Consistency,
@@ -222,6 +520,10 @@ type BulkRequest struct {
 }
 
 func (r BulkRequest) Request(uri *url.URL) (*http.Request, error) {
+	if err := r.Params.Validate(); err != nil {
+		return nil, err
+	}
+
 	uri.Path = "/_bulk"
 	uri.RawQuery = r.Params.Values().Encode()
 
@@ -238,5 +540,5 @@ func (r BulkRequest) Request(uri *url.URL) (*http.Request, error) {
 		}
 	}
 
-	return http.NewRequest("PUT", uri.String(), buf)
+	return newRequest("PUT", uri.String(), contentTypeNDJSON, buf)
 }
@@ -3,7 +3,10 @@ package elasticsearch_test
 import (
 	"encoding/json"
 	es "github.com/peterbourgon/elasticsearch"
+	"io/ioutil"
 	"net/url"
+	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -222,6 +225,211 @@ func TestDeleteRequest(t *testing.T) {
 	}
 }
 
+func TestBulkRequestMetadata(t *testing.T) {
+	request, err := es.BulkRequest{
+		Requests: []es.BulkIndexable{
+			es.IndexRequest{
+				es.IndexParams{
+					Index:       "twitter",
+					Type:        "tweet",
+					Id:          "1",
+					Parent:      "2",
+					Routing:     "foo",
+					Version:     "3",
+					VersionType: "external",
+					Consistency: "quorum",
+					Percolate:   "*",
+					Refresh:     "true",
+					Replication: "async",
+				},
+				map[string]string{"user": "kimchy"},
+			},
+		},
+	}.Request(&url.URL{})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var header struct {
+		Index map[string]string `json:"index"`
+	}
+	if err := json.NewDecoder(request.Body).Decode(&header); err != nil {
+		t.Fatal(err)
+	}
+
+	for key, expected := range map[string]string{
+		"_index":        "twitter",
+		"_type":         "tweet",
+		"_id":           "1",
+		"_parent":       "2",
+		"_routing":      "foo",
+		"_version":      "3",
+		"_version_type": "external",
+	} {
+		if got := header.Index[key]; expected != got {
+			t.Errorf("expected %s = %q; got %q", key, expected, got)
+		}
+	}
+
+	for _, key := range []string{"_consistency", "_percolate", "_refresh", "_replication"} {
+		if value, ok := header.Index[key]; ok {
+			t.Errorf("expected no %s in action metadata; got %q", key, value)
+		}
+	}
+}
+
+func TestBulkRequestUpdate(t *testing.T) {
+	request, err := es.BulkRequest{
+		Requests: []es.BulkIndexable{
+			es.UpdateRequest{
+				es.IndexParams{
+					Index: "twitter",
+					Type:  "tweet",
+					Id:    "1",
+				},
+				es.UpdateSource{
+					Doc:         map[string]string{"user": "kimchy"},
+					DocAsUpsert: true,
+				},
+			},
+		},
+	}.Request(&url.URL{})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body, err := ioutil.ReadAll(request.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(string(body)), "\n")
+	if expected, got := 2, len(lines); expected != got {
+		t.Fatalf("expected %d line(s); got %d: %q", expected, got, lines)
+	}
+
+	if expected, got := `{"update":{"_index":"twitter","_type":"tweet","_id":"1"}}`, lines[0]; expected != got {
+		t.Errorf("expected header %s; got %s", expected, got)
+	}
+
+	if expected, got := `{"doc":{"user":"kimchy"},"doc_as_upsert":true}`, lines[1]; expected != got {
+		t.Errorf("expected source %s; got %s", expected, got)
+	}
+}
+
+func TestBulkRequestMixedUpdate(t *testing.T) {
+	p := es.IndexParams{Index: "twitter", Type: "tweet", Id: "1"}
+	request, err := es.BulkRequest{
+		Requests: []es.BulkIndexable{
+			es.IndexRequest{p, map[string]string{"user": "kimchy"}},
+			es.UpdateRequest{p, map[string]interface{}{"likes": 1}},
+			es.UpdateRequest{p, es.UpdateSource{Doc: map[string]int{"likes": 2}, DocAsUpsert: true}},
+			es.DeleteRequest{p},
+		},
+	}.Request(&url.URL{})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body, err := ioutil.ReadAll(request.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(string(body)), "\n")
+	for i, expected := range []string{
+		`{"index":{"_index":"twitter","_type":"tweet","_id":"1"}}`,
+		`{"user":"kimchy"}`,
+		`{"update":{"_index":"twitter","_type":"tweet","_id":"1"}}`,
+		`{"doc":{"likes":1}}`,
+		`{"update":{"_index":"twitter","_type":"tweet","_id":"1"}}`,
+		`{"doc":{"likes":2},"doc_as_upsert":true}`,
+		`{"delete":{"_index":"twitter","_type":"tweet","_id":"1"}}`,
+	} {
+		if i >= len(lines) {
+			t.Fatalf("expected at least %d line(s); got %d", i+1, len(lines))
+		}
+		if got := lines[i]; expected != got {
+			t.Errorf("line %d: expected %s; got %s", i+1, expected, got)
+		}
+	}
+	if expected, got := 7, len(lines); expected != got {
+		t.Errorf("expected %d line(s); got %d", expected, got)
+	}
+}
+
+func TestRetryOnConflictQuery(t *testing.T) {
+	p := es.IndexParams{Index: "twitter", Type: "tweet", Id: "1", RetryOnConflict: "3"}
+
+	request, err := es.UpdateRequest{p, es.UpdateSource{Script: "ctx._source.likes += 1"}}.Request(&url.URL{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected, got := "3", request.URL.Query().Get("retry_on_conflict"); expected != got {
+		t.Errorf("expected update retry_on_conflict = %q; got %q", expected, got)
+	}
+
+	request, err = es.IndexRequest{p, map[string]string{"user": "kimchy"}}.Request(&url.URL{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := request.URL.Query()["retry_on_conflict"]; ok {
+		t.Errorf("expected no retry_on_conflict in index request; got %q", request.URL.RawQuery)
+	}
+}
+
+func TestBulkRequestRetryOnConflict(t *testing.T) {
+	p := es.IndexParams{Index: "twitter", Type: "tweet", Id: "1", RetryOnConflict: "3"}
+	request, err := es.BulkRequest{
+		Requests: []es.BulkIndexable{
+			es.UpdateRequest{p, es.UpdateSource{Script: "ctx._source.likes += 1"}},
+			es.IndexRequest{p, map[string]string{"user": "kimchy"}},
+		},
+	}.Request(&url.URL{})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body, err := ioutil.ReadAll(request.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(string(body)), "\n")
+	if expected, got := 4, len(lines); expected != got {
+		t.Fatalf("expected %d line(s); got %d: %q", expected, got, lines)
+	}
+
+	if expected, got := `{"update":{"_index":"twitter","_type":"tweet","_id":"1","_retry_on_conflict":"3"}}`, lines[0]; expected != got {
+		t.Errorf("expected update header %s; got %s", expected, got)
+	}
+
+	if expected, got := `{"index":{"_index":"twitter","_type":"tweet","_id":"1"}}`, lines[2]; expected != got {
+		t.Errorf("expected index header %s; got %s", expected, got)
+	}
+}
+
+func TestBulkResponseUpdate(t *testing.T) {
+	var response es.BulkResponse
+	if err := json.Unmarshal([]byte(`{"took":2,"items":[
+		{"update":{"_index":"twitter","_type":"tweet","_id":"1","_version":2,"ok":true}}
+	]}`), &response); err != nil {
+		t.Fatal(err)
+	}
+
+	if expected, got := 1, len(response.Items); expected != got {
+		t.Fatalf("expected %d item(s); got %d", expected, got)
+	}
+
+	if expected, got := 2, response.Items[0].Version; expected != got {
+		t.Errorf("expected version %d; got %d", expected, got)
+	}
+}
+
 func TestBulkRequest(t *testing.T) {
 	request, err := es.BulkRequest{
 		es.BulkParams{
@@ -268,6 +476,10 @@ func TestBulkRequest(t *testing.T) {
 		t.Errorf("expected path = %q; got %q", expected, got)
 	}
 
+	if expected, got := "application/x-ndjson", request.Header.Get("Content-Type"); expected != got {
+		t.Errorf("expected Content-Type = %q; got %q", expected, got)
+	}
+
 	q := request.URL.Query()
 
 	if expected, got := "quorum", q.Get("consistency"); expected != got {
@@ -368,3 +580,354 @@ func TestBulkRequest(t *testing.T) {
 		t.Errorf("expected _id = %q; got %q", expected, got)
 	}
 }
+
+func TestUpdateSource(t *testing.T) {
+	for _, tuple := range []struct {
+		source   es.UpdateSource
+		expected string
+	}{
+		{
+			source: es.UpdateSource{
+				Doc: map[string]string{"name": "new_name"},
+			},
+			expected: `{"doc":{"name":"new_name"}}`,
+		},
+		{
+			source: es.UpdateSource{
+				Doc:         map[string]string{"name": "new_name"},
+				DocAsUpsert: true,
+			},
+			expected: `{"doc":{"name":"new_name"},"doc_as_upsert":true}`,
+		},
+		{
+			source: es.UpdateSource{
+				Script: "ctx._source.counter += 1",
+				Upsert: map[string]int{"counter": 1},
+			},
+			expected: `{"script":"ctx._source.counter += 1","upsert":{"counter":1}}`,
+		},
+		{
+			source: es.UpdateSource{
+				Script:         "ctx._source.counter += 1",
+				ScriptedUpsert: true,
+				Upsert:         map[string]int{},
+			},
+			expected: `{"script":"ctx._source.counter += 1","scripted_upsert":true,"upsert":{}}`,
+		},
+	} {
+		request, err := es.UpdateRequest{
+			Params: es.IndexParams{Index: "twitter", Type: "tweet", Id: "1"},
+			Source: tuple.source,
+		}.Request(&url.URL{})
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		body, err := ioutil.ReadAll(request.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if expected, got := tuple.expected+"\n", string(body); expected != got {
+			t.Errorf("expected body = %q; got %q", expected, got)
+		}
+	}
+}
+
+func TestIndexParamsFields(t *testing.T) {
+	for _, tuple := range []struct {
+		p        es.IndexParams
+		expected string
+	}{
+		{es.IndexParams{}, ""},
+		{es.IndexParams{Fields: []string{"user"}}, "fields=user"},
+		{es.IndexParams{Fields: []string{"user", "post_date"}}, "fields=user%2Cpost_date"},
+	} {
+		if expected, got := tuple.expected, tuple.p.Values().Encode(); expected != got {
+			t.Errorf("expected %q; got %q", expected, got)
+		}
+	}
+}
+
+func TestIndexParamsValidation(t *testing.T) {
+	for _, p := range []es.IndexParams{
+		es.IndexParams{Type: "tweet", Id: "1"},
+		es.IndexParams{Index: "twitter", Id: "1"},
+		es.IndexParams{Index: "twitter", Type: "tweet"},
+	} {
+		for _, f := range []es.Fireable{
+			es.CreateRequest{p, nil},
+			es.UpdateRequest{p, nil},
+			es.DeleteRequest{p},
+		} {
+			if _, err := f.Request(&url.URL{}); err == nil {
+				t.Errorf("%T %+v: expected error, got none", f, p)
+			}
+		}
+	}
+
+	for _, p := range []es.IndexParams{
+		es.IndexParams{Type: "tweet", Id: "1"},
+		es.IndexParams{Index: "twitter", Id: "1"},
+	} {
+		if _, err := (es.IndexRequest{p, nil}).Request(&url.URL{}); err == nil {
+			t.Errorf("IndexRequest %+v: expected error, got none", p)
+		}
+	}
+}
+
+func TestIndexRequestWithoutId(t *testing.T) {
+	request, err := es.IndexRequest{
+		es.IndexParams{Index: "twitter", Type: "tweet"},
+		map[string]string{"user": "kimchy"},
+	}.Request(&url.URL{})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expected, got := "POST", request.Method; expected != got {
+		t.Errorf("expected method = %q; got %q", expected, got)
+	}
+
+	if expected, got := "/twitter/tweet", request.URL.Path; expected != got {
+		t.Errorf("expected path = %q; got %q", expected, got)
+	}
+}
+
+func TestRequestPathsAreAbsolute(t *testing.T) {
+	p := es.IndexParams{Index: "twitter", Type: "tweet", Id: "1"}
+	for _, f := range []es.Fireable{
+		es.IndexRequest{p, nil},
+		es.IndexRequest{es.IndexParams{Index: "twitter", Type: "tweet"}, nil},
+		es.CreateRequest{p, nil},
+		es.UpdateRequest{p, nil},
+		es.DeleteRequest{p},
+		es.BulkRequest{Requests: []es.BulkIndexable{es.DeleteRequest{p}}},
+		es.SearchRequest{},
+		es.SearchRequest{Params: es.SearchParams{Indices: []string{"twitter"}}},
+		es.MultiSearchRequest{},
+	} {
+		request, err := f.Request(&url.URL{})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got := request.URL.Path; !strings.HasPrefix(got, "/") {
+			t.Errorf("%T: expected path to start with '/'; got %q", f, got)
+		}
+	}
+}
+
+func TestRequestPathEscaping(t *testing.T) {
+	p := es.IndexParams{Index: "twitter", Type: "tweet", Id: "http://x/y z"}
+	for _, tuple := range []struct {
+		f        es.Fireable
+		expected string
+	}{
+		{es.IndexRequest{p, nil}, "/twitter/tweet/http:%2F%2Fx%2Fy%20z"},
+		{es.CreateRequest{p, nil}, "/twitter/tweet/http:%2F%2Fx%2Fy%20z/_create"},
+		{es.UpdateRequest{p, nil}, "/twitter/tweet/http:%2F%2Fx%2Fy%20z/_update"},
+		{es.DeleteRequest{p}, "/twitter/tweet/http:%2F%2Fx%2Fy%20z"},
+	} {
+		request, err := tuple.f.Request(&url.URL{Scheme: "http", Host: "localhost:9200"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if expected, got := tuple.expected, request.URL.EscapedPath(); expected != got {
+			t.Errorf("%T: expected path = %q; got %q", tuple.f, expected, got)
+		}
+
+		if expected, got := "http://localhost:9200"+tuple.expected, request.URL.String(); expected != got {
+			t.Errorf("%T: expected URL = %q; got %q", tuple.f, expected, got)
+		}
+	}
+}
+
+func TestRefreshPolicy(t *testing.T) {
+	for _, tuple := range []struct {
+		refresh string
+		valid   bool
+	}{
+		{"", true},
+		{es.RefreshTrue, true},
+		{es.RefreshFalse, true},
+		{es.RefreshWaitFor, true},
+		{"yes", false},
+		{"waitfor", false},
+	} {
+		p := es.IndexParams{Index: "twitter", Type: "tweet", Id: "1", Refresh: tuple.refresh}
+
+		for _, f := range []es.Fireable{
+			es.IndexRequest{p, map[string]string{"user": "kimchy"}},
+			es.DeleteRequest{p},
+			es.BulkRequest{Params: es.BulkParams{Refresh: tuple.refresh}},
+		} {
+			request, err := f.Request(&url.URL{})
+			if !tuple.valid {
+				if err == nil {
+					t.Errorf("%T %q: expected error, got none", f, tuple.refresh)
+				}
+				continue
+			}
+
+			if err != nil {
+				t.Errorf("%T %q: %s", f, tuple.refresh, err)
+				continue
+			}
+
+			if expected, got := tuple.refresh, request.URL.Query().Get("refresh"); expected != got {
+				t.Errorf("%T: expected refresh = %q; got %q", f, expected, got)
+			}
+		}
+	}
+}
+
+func TestIndexRequestOpType(t *testing.T) {
+	for _, tuple := range []struct {
+		opType   string
+		expected []string
+	}{
+		{"", nil},
+		{"create", []string{"create"}},
+	} {
+		request, err := es.IndexRequest{
+			es.IndexParams{Index: "twitter", Type: "tweet", Id: "1", OpType: tuple.opType},
+			map[string]string{"user": "kimchy"},
+		}.Request(&url.URL{})
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if expected, got := tuple.expected, request.URL.Query()["op_type"]; !reflect.DeepEqual(expected, got) {
+			t.Errorf("expected op_type = %v; got %v", expected, got)
+		}
+	}
+}
+
+func TestGetRequest(t *testing.T) {
+	yes, no := true, false
+	for _, tuple := range []struct {
+		sourceEnabled *bool
+		expected      []string
+	}{
+		{nil, nil},
+		{&yes, nil},
+		{&no, []string{"false"}},
+	} {
+		request, err := es.GetRequest{
+			Params:        es.IndexParams{Index: "twitter", Type: "tweet", Id: "1"},
+			SourceEnabled: tuple.sourceEnabled,
+		}.Request(&url.URL{})
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if expected, got := "GET", request.Method; expected != got {
+			t.Errorf("expected method = %q; got %q", expected, got)
+		}
+
+		if expected, got := "/twitter/tweet/1", request.URL.Path; expected != got {
+			t.Errorf("expected path = %q; got %q", expected, got)
+		}
+
+		if expected, got := tuple.expected, request.URL.Query()["_source"]; !reflect.DeepEqual(expected, got) {
+			t.Errorf("expected _source = %v; got %v", expected, got)
+		}
+	}
+
+	if _, err := (es.GetRequest{Params: es.IndexParams{Index: "twitter", Type: "tweet"}}).Request(&url.URL{}); err == nil {
+		t.Errorf("expected error with no id, got none")
+	}
+}
+
+func TestTermVectorsRequest(t *testing.T) {
+	request, err := es.TermVectorsRequest{
+		Index:  "twitter",
+		Type:   "tweet",
+		Id:     "1",
+		Fields: []string{"text", "user"},
+	}.Request(&url.URL{})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expected, got := "GET", request.Method; expected != got {
+		t.Errorf("expected method = %q; got %q", expected, got)
+	}
+
+	if expected, got := "/twitter/tweet/1/_termvectors", request.URL.Path; expected != got {
+		t.Errorf("expected path = %q; got %q", expected, got)
+	}
+
+	if expected, got := "text,user", request.URL.Query().Get("fields"); expected != got {
+		t.Errorf("expected fields = %q; got %q", expected, got)
+	}
+
+	if _, err := (es.TermVectorsRequest{Index: "twitter", Type: "tweet"}).Request(&url.URL{}); err == nil {
+		t.Errorf("expected error with no id, got none")
+	}
+}
+
+func TestTermVectorsResponse(t *testing.T) {
+	data := []byte(`{
+		"_index": "twitter",
+		"_type": "tweet",
+		"_id": "1",
+		"_version": 1,
+		"found": true,
+		"term_vectors": {
+			"text": {
+				"field_statistics": {"sum_doc_freq": 6, "doc_count": 2, "sum_ttf": 8},
+				"terms": {
+					"test": {
+						"doc_freq": 2,
+						"ttf": 4,
+						"term_freq": 3,
+						"tokens": [
+							{"position": 1, "start_offset": 10, "end_offset": 14},
+							{"position": 2, "start_offset": 15, "end_offset": 19},
+							{"position": 3, "start_offset": 20, "end_offset": 24}
+						]
+					}
+				}
+			}
+		}
+	}`)
+
+	var response es.TermVectorsResponse
+	if err := json.Unmarshal(data, &response); err != nil {
+		t.Fatal(err)
+	}
+
+	text, ok := response.TermVectors["text"]
+	if !ok {
+		t.Fatal("text term vectors were not decoded")
+	}
+
+	if expected, got := int64(2), text.FieldStatistics.DocCount; expected != got {
+		t.Errorf("expected doc_count = %d; got %d", expected, got)
+	}
+
+	term := text.Terms["test"]
+	if expected, got := 3, term.TermFreq; expected != got {
+		t.Errorf("expected term_freq = %d; got %d", expected, got)
+	}
+
+	if expected, got := int64(4), term.TTF; expected != got {
+		t.Errorf("expected ttf = %d; got %d", expected, got)
+	}
+
+	if expected, got := 3, len(term.Tokens); expected != got {
+		t.Fatalf("expected %d token(s); got %d", expected, got)
+	}
+
+	if expected, got := 15, term.Tokens[1].StartOffset; expected != got {
+		t.Errorf("expected start_offset = %d; got %d", expected, got)
+	}
+}
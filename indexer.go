@@ -0,0 +1,10 @@
+package elasticsearch
+
+// Indexer is the interface that wraps the methods which write documents.
+type Indexer interface {
+	Index(IndexRequest) (IndexResponse, error)
+	Create(CreateRequest) (IndexResponse, error)
+	Update(UpdateRequest) (IndexResponse, error)
+	Delete(DeleteRequest) (IndexResponse, error)
+	Bulk(BulkRequest) (BulkResponse, error)
+}
@@ -0,0 +1,67 @@
+package elasticsearch_test
+
+import (
+	es "github.com/peterbourgon/elasticsearch"
+	"testing"
+)
+
+// mockClient records the documents it's asked to index.
+type mockClient struct {
+	indexed []es.IndexParams
+}
+
+func (c *mockClient) Search(es.SearchRequest) (es.SearchResponse, error) {
+	return es.SearchResponse{}, nil
+}
+
+func (c *mockClient) MultiSearch(es.MultiSearchRequest) (es.MultiSearchResponse, error) {
+	return es.MultiSearchResponse{}, nil
+}
+
+func (c *mockClient) Index(r es.IndexRequest) (es.IndexResponse, error) {
+	c.indexed = append(c.indexed, r.Params)
+	return es.IndexResponse{ID: r.Params.Id, Version: 1}, nil
+}
+
+func (c *mockClient) Create(r es.CreateRequest) (es.IndexResponse, error) {
+	return c.Index(es.IndexRequest{Params: r.Params, Source: r.Source})
+}
+
+func (c *mockClient) Update(es.UpdateRequest) (es.IndexResponse, error) {
+	return es.IndexResponse{}, nil
+}
+
+func (c *mockClient) Delete(es.DeleteRequest) (es.IndexResponse, error) {
+	return es.IndexResponse{}, nil
+}
+
+func (c *mockClient) Bulk(es.BulkRequest) (es.BulkResponse, error) {
+	return es.BulkResponse{}, nil
+}
+
+// saveTweet stands in for business logic which depends on the interface.
+func saveTweet(c es.Indexer, id, user string) error {
+	_, err := c.Index(es.IndexRequest{
+		Params: es.IndexParams{Index: "twitter", Type: "tweet", Id: id},
+		Source: map[string]string{"user": user},
+	})
+	return err
+}
+
+func TestClientMock(t *testing.T) {
+	var c es.Client = &mockClient{}
+
+	if err := saveTweet(c, "1", "kimchy"); err != nil {
+		t.Fatal(err)
+	}
+
+	indexed := c.(*mockClient).indexed
+
+	if expected, got := 1, len(indexed); expected != got {
+		t.Fatalf("expected %d indexed document(s); got %d", expected, got)
+	}
+
+	if expected, got := "1", indexed[0].Id; expected != got {
+		t.Errorf("expected id = %q; got %q", expected, got)
+	}
+}
@@ -1,13 +1,19 @@
 package elasticsearch
 
 import (
+	"bytes"
+	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"log"
 	"math/rand"
 	"net"
 	"net/http"
 	"net/url"
+	"strings"
 	"sync"
 	"time"
 )
@@ -17,73 +23,219 @@ type Node struct {
 	sync.RWMutex
 	endpoint   string
 	health     Health
+	latency    time.Duration // EWMA of Execute latency; 0 is unknown
+	failures   int           // consecutive Execute failures
+	openUntil  time.Time     // circuit breaker is open until this time
+	probing    bool          // a request is testing the half-open breaker
+	backoff    int           // ping intervals between pings; 0 is every one
+	skip       int           // ping intervals to skip before the next ping
+	version    string        // as reported by the last ping of "/"
+	cluster    string        // cluster name, likewise
+	config     nodeConfig
 	client     *http.Client // default http client
 	pingClient *http.Client // used for Ping() only
 }
 
+// nodeConfig holds the settings which a Cluster applies to each of its Nodes.
+// The zero value of each setting preserves the default behavior.
+type nodeConfig struct {
+	pingTimeout     time.Duration
+	requestTimeout  time.Duration // 0 is no timeout
+	maxResponseSize int64         // bytes; 0 is unlimited
+
+	pingPath string                    // "" is "/"
+	pingOK   func(*http.Response) bool // nil is HTTP 200
+
+	breakerThreshold int // consecutive failures; 0 disables the breaker
+	breakerCooldown  time.Duration
+
+	tlsConfig *tls.Config // nil is the default configuration
+	logger    Logger      // nil is the standard logger
+}
+
 // NewNode constructs a Node handle. The endpoint should be of the form
-// "scheme://host:port", eg. "http://es001:9200".
+// "scheme://host:port", eg. "http://es001:9200". Both http and https schemes
+// are supported, for pings as well as regular queries.
 //
 // The ping interval is dictated at a higher level (the Cluster), but individual
 // ping timeouts are stored with the Nodes themselves, in a custom HTTP client,
-// with a timeout as part of the Transport dialer. This custom pingClient is
-// used exclusively for Ping() calls.
+// with a timeout as part of the Transport dialer, and on the client as a
+// whole. This custom pingClient is used exclusively for Ping() calls. With an
+// https endpoint, the dialer timeout also bounds the TLS handshake.
 //
-// Regular queries are made with the default client http.Client, which has
-// no explicit timeout set in the Transport dialer.
+// Regular queries are made with a separate client, which has no timeout,
+// unless the Node belongs to a Cluster created with WithRequestTimeout.
 func NewNode(endpoint string, pingTimeout time.Duration) *Node {
+	return newNode(endpoint, nodeConfig{pingTimeout: pingTimeout})
+}
+
+func newNode(endpoint string, config nodeConfig) *Node {
 	return &Node{
 		endpoint: endpoint,
 		health:   Yellow,
+		config:   config,
 		client: &http.Client{
 			Transport: &http.Transport{
 				MaxIdleConnsPerHost: 250,
+				TLSClientConfig:     config.tlsConfig,
 			},
+			Timeout: config.requestTimeout,
 		},
 		pingClient: &http.Client{
 			Transport: &http.Transport{
-				Dial: timeoutDialer(pingTimeout),
+				Dial:            timeoutDialer(config.pingTimeout),
+				TLSClientConfig: config.tlsConfig,
 			},
+			Timeout: config.pingTimeout,
 		},
 	}
 }
 
-// Ping attempts to HTTP GET a specific endpoint, parse some kind of
-// status indicator, and returns true if everything was successful.
+// Ping attempts to HTTP GET a specific endpoint, and returns true if the
+// response indicates a healthy Node. By default, it's a GET of "/", which
+// must return HTTP 200; a Cluster may change both with WithPing.
 func (n *Node) Ping() bool {
 	u, err := url.Parse(n.endpoint)
 	if err != nil {
-		log.Printf("ElasticSearch: ping: resolve: %s", err)
+		n.logf("ElasticSearch: ping: resolve: %s", err)
 		return false
 	}
-	u.Path = "/_cluster/nodes/_local" // some arbitrary, reasonable endpoint
+	u.Path = n.config.pingPath
+	if u.Path == "" {
+		u.Path = "/"
+	}
 
 	resp, err := n.pingClient.Get(u.String())
 	if err != nil {
-		log.Printf("ElasticSearch: ping %s: GET: %s", u.Host, err)
+		n.logf("ElasticSearch: ping %s: GET: %s", u.Host, err)
 		return false
 	}
 	defer resp.Body.Close()
 
-	var status struct {
-		OK bool `json:"ok"`
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		n.logf("ElasticSearch: ping %s: read: %s", u.Host, err)
+		return false
 	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
 
-	if err = json.NewDecoder(resp.Body).Decode(&status); err != nil {
-		log.Printf("ElasticSearch: ping %s: %s", u.Host, err)
-		return false
+	ok := n.config.pingOK
+	if ok == nil {
+		ok = func(resp *http.Response) bool { return resp.StatusCode == http.StatusOK }
 	}
 
-	if !status.OK {
-		log.Printf("ElasticSearch: ping %s: ok=false", u.Host)
+	if !ok(resp) {
+		n.logf("ElasticSearch: ping %s: unhealthy response (%s)", u.Host, resp.Status)
 		return false
 	}
 
+	if u.Path == "/" {
+		n.recordInfo(body)
+	}
 	return true
 }
 
-// PingAndSet performs a Ping, and updates the Node's health accordingly.
-func (n *Node) pingAndSet() {
+// recordInfo stores the cluster name and version from the body of a
+// successful ping of "/". A body without them leaves the previous values.
+func (n *Node) recordInfo(body []byte) {
+	var info struct {
+		ClusterName string `json:"cluster_name"`
+		Version     struct {
+			Number string `json:"number"`
+		} `json:"version"`
+	}
+	if err := json.Unmarshal(body, &info); err != nil || info.Version.Number == "" {
+		return
+	}
+
+	n.Lock()
+	defer n.Unlock()
+	n.cluster = info.ClusterName
+	n.version = info.Version.Number
+}
+
+// Version returns the ElasticSearch version the Node reported, eg. "7.10.2",
+// as of its last successful ping. It's empty until then, or if the Node is
+// pinged somewhere other than "/".
+func (n *Node) Version() string {
+	n.RLock()
+	defer n.RUnlock()
+	return n.version
+}
+
+// ClusterName returns the name of the cluster the Node reported, as of its
+// last successful ping. Like Version, it may be empty.
+func (n *Node) ClusterName() string {
+	n.RLock()
+	defer n.RUnlock()
+	return n.cluster
+}
+
+// compareVersions compares two ElasticSearch versions, eg. "6.8.23", part by
+// part, returning -1, 0 or 1 as a is lower than, equal to or higher than b.
+// Suffixes like "-SNAPSHOT" are ignored.
+func compareVersions(a, b string) int {
+	pa, pb := versionParts(a), versionParts(b)
+	for i := 0; i < len(pa) || i < len(pb); i++ {
+		var x, y int
+		if i < len(pa) {
+			x = pa[i]
+		}
+		if i < len(pb) {
+			y = pb[i]
+		}
+		switch {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		}
+	}
+	return 0
+}
+
+// majorVersion returns the major part of the version, or 0 if it's unknown.
+func majorVersion(version string) int {
+	if parts := versionParts(version); len(parts) > 0 {
+		return parts[0]
+	}
+	return 0
+}
+
+// versionParts returns the leading numeric parts of the version.
+func versionParts(version string) []int {
+	parts := []int{}
+	for _, s := range strings.Split(version, ".") {
+		n, digits := 0, 0
+		for _, r := range s {
+			if r < '0' || r > '9' {
+				break
+			}
+			n, digits = 10*n+int(r-'0'), digits+1
+		}
+		if digits == 0 {
+			break
+		}
+		parts = append(parts, n)
+		if digits < len(s) {
+			break // eg. "0-beta1"
+		}
+	}
+	return parts
+}
+
+// logf writes a diagnostic to the Node's Logger.
+func (n *Node) logf(format string, args ...interface{}) {
+	if n.config.logger == nil {
+		log.Printf(format, args...)
+		return
+	}
+	n.config.logger.Printf(format, args...)
+}
+
+// PingAndSet performs a Ping, and updates the Node's health accordingly. It
+// returns the result of the Ping. It leaves the Node's ping backoff alone.
+func (n *Node) pingAndSet() bool {
 	success := n.Ping()
 	func() {
 		n.Lock()
@@ -94,36 +246,220 @@ func (n *Node) pingAndSet() {
 			n.health = n.health.Degrade()
 		}
 	}()
+	return success
+}
+
+// scheduledPing is called once per ping interval. Unless the Node is backing
+// off, it performs a PingAndSet, and updates the backoff with the result.
+// It returns true if the Node answered a ping.
+func (n *Node) scheduledPing() bool {
+	if !n.pingDue() {
+		return false
+	}
+	success := n.pingAndSet()
+	n.Lock()
+	defer n.Unlock()
+	if success {
+		n.backoff, n.skip = 0, 0
+	} else {
+		n.backoff = nextPingBackoff(n.backoff)
+		n.skip = n.backoff - 1
+	}
+	return success
+}
+
+// maxPingBackoff is the most ping intervals allowed between two pings of a
+// Node which keeps failing them.
+const maxPingBackoff = 32
+
+// nextPingBackoff doubles the backoff after a failed ping, up to the maximum.
+func nextPingBackoff(backoff int) int {
+	switch {
+	case backoff <= 0:
+		return 2
+	case 2*backoff > maxPingBackoff:
+		return maxPingBackoff
+	default:
+		return 2 * backoff
+	}
+}
+
+// pingDue returns true if the Node should be pinged in this ping interval, ie.
+// it's not backing off after failed pings. Only scheduledPing may call it, as
+// each call counts down the intervals to skip.
+func (n *Node) pingDue() bool {
+	n.Lock()
+	defer n.Unlock()
+	if n.skip > 0 {
+		n.skip--
+		return false
+	}
+	return true
 }
 
 // GetHealth returns the health of the node, for use in the Cluster's GetBest.
+// A Node whose circuit breaker is open is Red, regardless of its pings. So is
+// a Node whose breaker is half-open, while a probe request is in flight.
 func (n *Node) GetHealth() Health {
 	n.RLock()
 	defer n.RUnlock()
+	if time.Now().Before(n.openUntil) || (n.halfOpen() && n.probing) {
+		return Red
+	}
 	return n.health
 }
 
+// halfOpen reports whether the Node's circuit breaker has tripped, and its
+// cooldown has elapsed, so that a single request may probe the Node. The
+// caller must hold the lock.
+func (n *Node) halfOpen() bool {
+	return n.config.breakerThreshold > 0 &&
+		n.failures >= n.config.breakerThreshold &&
+		!time.Now().Before(n.openUntil)
+}
+
+// acquire claims the Node for a request. It fails only if the Node's breaker
+// is half-open, and another request is already probing it.
+func (n *Node) acquire() bool {
+	n.Lock()
+	defer n.Unlock()
+	if !n.halfOpen() {
+		return true
+	}
+	if n.probing {
+		return false
+	}
+	n.probing = true
+	return true
+}
+
+// recordResult updates the Node's circuit breaker with the outcome of an
+// Execute. Once the failure threshold is reached, every further failure
+// (re)opens the breaker; any success closes it. Either way, it ends a probe.
+func (n *Node) recordResult(failed bool) {
+	if n.config.breakerThreshold <= 0 {
+		return
+	}
+	n.Lock()
+	defer n.Unlock()
+	n.probing = false
+	if !failed {
+		n.failures = 0
+		return
+	}
+	n.failures++
+	if n.failures >= n.config.breakerThreshold {
+		n.openUntil = time.Now().Add(n.config.breakerCooldown)
+	}
+}
+
+// abandonProbe ends a probe whose request was never sent, so that another
+// request may probe the Node instead.
+func (n *Node) abandonProbe() {
+	n.Lock()
+	defer n.Unlock()
+	n.probing = false
+}
+
+// latencyWeight is the weight given to each new sample in a Node's latency
+// EWMA. Higher values make the average more responsive to recent requests.
+const latencyWeight = 0.3
+
+// recordLatency folds the duration of a request into the Node's latency EWMA.
+func (n *Node) recordLatency(d time.Duration) {
+	n.Lock()
+	defer n.Unlock()
+	if n.latency == 0 {
+		n.latency = d
+		return
+	}
+	n.latency += time.Duration(latencyWeight * float64(d-n.latency))
+}
+
+// failurePenalty is the least latency recorded for a failed request. Without
+// it, a Node which fails quickly would look faster than its healthy peers,
+// and be preferred over them.
+const failurePenalty = time.Second
+
+// failureLatency returns the latency to record for a failed request which
+// took d.
+func failureLatency(d time.Duration) time.Duration {
+	if d < failurePenalty {
+		return failurePenalty
+	}
+	return d
+}
+
+// getLatency returns the Node's latency EWMA, or 0 if it's not yet known.
+func (n *Node) getLatency() time.Duration {
+	n.RLock()
+	defer n.RUnlock()
+	return n.latency
+}
+
 // Executes the Fireable f against the node and decodes the server's reply into
 // response.
 func (n *Node) Execute(f Fireable, response interface{}) error {
 	uri, err := url.Parse(n.endpoint)
 	if err != nil {
+		n.abandonProbe()
 		return err
 	}
 
 	request, err := f.Request(uri)
 	if err != nil {
+		n.abandonProbe()
 		return err
 	}
 
+	began := time.Now()
 	r, err := n.client.Do(request)
 	if err != nil {
+		n.recordLatency(failureLatency(time.Since(began)))
+		n.recordResult(true)
 		return err
 	}
+	if r.StatusCode >= 500 {
+		n.recordLatency(failureLatency(time.Since(began)))
+	} else {
+		n.recordLatency(time.Since(began))
+	}
+	n.recordResult(r.StatusCode >= 500)
 
 	defer r.Body.Close()
 
-	return json.NewDecoder(r.Body).Decode(response)
+	var body io.Reader = r.Body
+	if n.config.maxResponseSize > 0 {
+		body = &limitedReader{r: r.Body, n: n.config.maxResponseSize + 1}
+	}
+
+	return json.NewDecoder(body).Decode(response)
+}
+
+// ErrResponseTooLarge is returned by Execute when the server's reply exceeds
+// the maximum response size. See WithMaxResponseSize.
+var ErrResponseTooLarge = errors.New("response too large")
+
+// limitedReader is like an io.LimitedReader, except that it returns an error,
+// rather than EOF, once the limit has been reached.
+type limitedReader struct {
+	r io.Reader
+	n int64 // bytes remaining, including one beyond the maximum
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	if l.n <= 0 {
+		return 0, ErrResponseTooLarge
+	}
+	if int64(len(p)) > l.n {
+		p = p[:l.n]
+	}
+	n, err := l.r.Read(p)
+	l.n -= int64(n)
+	if l.n <= 0 {
+		return n, ErrResponseTooLarge
+	}
+	return n, err
 }
 
 //
@@ -132,19 +468,37 @@ func (n *Node) Execute(f Fireable, response interface{}) error {
 
 type Nodes []*Node
 
-// PingAll triggers simultaneous PingAndSets across all Nodes,
-// and blocks until they've all completed.
-func (n Nodes) pingAll() {
+// PingAll triggers simultaneous scheduledPings across all Nodes, and blocks
+// until they've all completed. It returns true if any Node answered its ping.
+// It's called once per ping interval, by the Cluster's loop only.
+func (n Nodes) pingAll() bool {
+	return n.each((*Node).scheduledPing)
+}
+
+// PingAllNow is like pingAll, but pings every Node with a PingAndSet,
+// regardless of, and without changing, its ping backoff.
+func (n Nodes) pingAllNow() bool {
+	return n.each((*Node).pingAndSet)
+}
+
+// each calls ping simultaneously for every Node, and blocks until they've all
+// returned. It returns true if any call returned true.
+func (n Nodes) each(ping func(*Node) bool) bool {
 	c := make(chan bool, len(n))
 	for _, node := range n {
-		go func(tgt *Node) { tgt.pingAndSet(); c <- true }(node)
+		go func(tgt *Node) { c <- ping(tgt) }(node)
 	}
+	answered := false
 	for i := 0; i < cap(c); i++ {
-		<-c
+		if <-c {
+			answered = true
+		}
 	}
+	return answered
 }
 
 // GetBest returns the "best" Node, as decided by each Node's health.
+// Among green Nodes, it prefers those with lower recent latency.
 // It's possible that no Node will be healthy enough to be returned.
 // In that case, GetBest returns an error, and processing cannot continue.
 func (n Nodes) getBest() (*Node, error) {
@@ -159,7 +513,8 @@ func (n Nodes) getBest() (*Node, error) {
 	}
 
 	if len(green) > 0 {
-		return green[rand.Intn(len(green))], nil
+		fast := fastest(green)
+		return fast[rand.Intn(len(fast))], nil
 	}
 
 	if len(yellow) > 0 {
@@ -169,6 +524,45 @@ func (n Nodes) getBest() (*Node, error) {
 	return nil, fmt.Errorf("no healthy nodes available")
 }
 
+// acquireBest is like getBest, but also claims the Node for a request, so
+// that a Node with a half-open circuit breaker receives only one.
+func (n Nodes) acquireBest() (*Node, error) {
+	for {
+		node, err := n.getBest()
+		if err != nil {
+			return nil, err
+		}
+		if node.acquire() {
+			return node, nil
+		}
+		// Another request is probing the node, so it's now Red: choose again.
+	}
+}
+
+// latencySlack is how many times slower than the fastest Node another Node
+// may be, and still be considered comparable.
+const latencySlack = 2
+
+// fastest returns the Nodes whose latency is comparable to the fastest Node's.
+// Nodes with unknown latency are always included, so they get a chance to
+// establish one.
+func fastest(nodes []*Node) []*Node {
+	var min time.Duration
+	for _, node := range nodes {
+		if l := node.getLatency(); l > 0 && (min == 0 || l < min) {
+			min = l
+		}
+	}
+
+	fast := []*Node{}
+	for _, node := range nodes {
+		if l := node.getLatency(); l <= latencySlack*min || l == 0 {
+			fast = append(fast, node)
+		}
+	}
+	return fast
+}
+
 //
 //
 //
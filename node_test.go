@@ -0,0 +1,959 @@
+package elasticsearch_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"fmt"
+	es "github.com/peterbourgon/elasticsearch"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newStub returns a test server which answers pings, and serves the handler
+// for every other path.
+func newStub(h http.HandlerFunc) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/" {
+			return
+		}
+		h(w, r)
+	}))
+}
+
+func TestMaxResponseSize(t *testing.T) {
+	hits := strings.Repeat(`{"_index":"twitter","_type":"tweet","_id":"1"},`, 100)
+	stub := newStub(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"took":1,"hits":{"total":101,"hits":[%s{"_id":"2"}]}}`, hits)
+	})
+	defer stub.Close()
+
+	for _, tuple := range []struct {
+		max     int64
+		tooLong bool
+	}{
+		{0, false},
+		{1 << 20, false},
+		{1024, true},
+	} {
+		c := es.NewCluster([]string{stub.URL}, time.Minute, time.Second, es.WithMaxResponseSize(tuple.max))
+		response, err := c.Search(es.SearchRequest{})
+		c.Shutdown()
+
+		if tuple.tooLong {
+			if expected, got := es.ErrResponseTooLarge, err; expected != got {
+				t.Errorf("max %d: expected error %v; got %v", tuple.max, expected, got)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("max %d: %s", tuple.max, err)
+			continue
+		}
+
+		if expected, got := 101, len(response.HitsWrapper.Hits); expected != got {
+			t.Errorf("max %d: expected %d hit(s); got %d", tuple.max, expected, got)
+		}
+	}
+}
+
+func TestRequestTimeout(t *testing.T) {
+	done := make(chan struct{})
+	stub := newStub(func(w http.ResponseWriter, r *http.Request) {
+		select { // never respond
+		case <-r.Context().Done():
+		case <-done:
+		}
+	})
+	defer stub.Close()
+	defer close(done)
+
+	timeout := 50 * time.Millisecond
+	c := es.NewCluster([]string{stub.URL}, time.Minute, time.Second, es.WithRequestTimeout(timeout))
+	defer c.Shutdown()
+
+	errs := make(chan error)
+	go func() {
+		_, err := c.Search(es.SearchRequest{})
+		errs <- err
+	}()
+
+	select {
+	case err := <-errs:
+		if err == nil {
+			t.Errorf("expected timeout error, got none")
+		}
+	case <-time.After(20 * timeout):
+		t.Fatalf("Search didn't return within %s", 20*timeout)
+	}
+}
+
+func TestPingsDoNotAccumulate(t *testing.T) {
+	done := make(chan struct{})
+	stub := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select { // never respond, so pings take the full timeout
+		case <-r.Context().Done():
+		case <-done:
+		}
+	}))
+	defer stub.Close()
+	defer close(done)
+
+	c := es.NewCluster([]string{stub.URL, stub.URL, stub.URL}, 5*time.Millisecond, time.Second)
+	defer c.Shutdown()
+
+	time.Sleep(150 * time.Millisecond)
+	before := runtime.NumGoroutine()
+	time.Sleep(500 * time.Millisecond)
+	after := runtime.NumGoroutine()
+
+	if after-before > 10 {
+		t.Errorf("goroutines grew from %d to %d", before, after)
+	}
+}
+
+func TestWaitReady(t *testing.T) {
+	up := time.Now().Add(200 * time.Millisecond)
+	stub := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if time.Now().Before(up) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer stub.Close()
+
+	c := es.NewCluster([]string{stub.URL}, time.Minute, time.Second)
+	defer c.Shutdown()
+
+	if err := c.WaitReady(50 * time.Millisecond); err == nil {
+		t.Errorf("expected error before the stub is up, got none")
+	}
+
+	if err := c.WaitReady(2 * time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	if now := time.Now(); now.Before(up) {
+		t.Errorf("WaitReady returned %s before the stub was up", up.Sub(now))
+	}
+}
+
+func TestHealthy(t *testing.T) {
+	var healthy int32 = 1
+	stub := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&healthy) != 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer stub.Close()
+
+	c := es.NewCluster([]string{stub.URL}, 5*time.Millisecond, time.Second)
+	defer c.Shutdown()
+
+	for _, expected := range []bool{true, false, true} {
+		if expected {
+			atomic.StoreInt32(&healthy, 1)
+		} else {
+			atomic.StoreInt32(&healthy, 0)
+		}
+
+		if !waitFor(time.Second, func() bool { return c.Healthy() == expected }) {
+			t.Fatalf("expected Healthy() = %v", expected)
+		}
+	}
+}
+
+// waitFor polls the condition until it's true, or the timeout elapses.
+func waitFor(timeout time.Duration, condition func() bool) bool {
+	giveUp := time.Now().Add(timeout)
+	for time.Now().Before(giveUp) {
+		if condition() {
+			return true
+		}
+		time.Sleep(time.Millisecond)
+	}
+	return condition()
+}
+
+func TestPreferLowLatency(t *testing.T) {
+	var fastHits, slowHits int32
+	fast := newStub(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&fastHits, 1)
+		fmt.Fprint(w, `{}`)
+	})
+	defer fast.Close()
+	slow := newStub(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&slowHits, 1)
+		time.Sleep(20 * time.Millisecond)
+		fmt.Fprint(w, `{}`)
+	})
+	defer slow.Close()
+
+	c := es.NewCluster([]string{fast.URL, slow.URL}, time.Minute, time.Second)
+	defer c.Shutdown()
+
+	if err := c.WaitReady(time.Second); err != nil { // Yellow -> Green
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 50; i++ {
+		if _, err := c.Search(es.SearchRequest{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	f, s := atomic.LoadInt32(&fastHits), atomic.LoadInt32(&slowHits)
+	if f < 40 {
+		t.Errorf("expected most requests on the fast node; got %d fast, %d slow", f, s)
+	}
+}
+
+func TestAvoidFastFailingNode(t *testing.T) {
+	var healthyHits, failingHits int32
+	healthy := newStub(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&healthyHits, 1)
+		time.Sleep(5 * time.Millisecond)
+		fmt.Fprint(w, `{}`)
+	})
+	defer healthy.Close()
+	failing := newStub(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&failingHits, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprint(w, `{}`)
+	})
+	defer failing.Close()
+
+	c := es.NewCluster([]string{healthy.URL, failing.URL}, time.Minute, time.Second)
+	defer c.Shutdown()
+
+	if err := c.WaitReady(time.Second); err != nil { // Yellow -> Green
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 50; i++ {
+		c.Search(es.SearchRequest{})
+	}
+
+	h, f := atomic.LoadInt32(&healthyHits), atomic.LoadInt32(&failingHits)
+	if h < 40 {
+		t.Errorf("expected most requests on the healthy node; got %d healthy, %d failing", h, f)
+	}
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	var failing, requests int32 = 1, 0
+	stub := newStub(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		if atomic.LoadInt32(&failing) == 1 {
+			time.Sleep(20 * time.Millisecond) // so concurrent requests overlap
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		fmt.Fprint(w, `{}`)
+	})
+	defer stub.Close()
+
+	cooldown := 100 * time.Millisecond
+	c := es.NewCluster([]string{stub.URL}, 5*time.Millisecond, time.Second, es.WithCircuitBreaker(3, cooldown))
+	defer c.Shutdown()
+
+	for i := 0; i < 3; i++ {
+		if _, err := c.Search(es.SearchRequest{}); err != nil {
+			t.Fatalf("request %d: %s", i+1, err)
+		}
+	}
+
+	// Pings still succeed, but the node should be out of rotation.
+	if c.Healthy() {
+		t.Errorf("expected node to be excluded after 3 failures")
+	}
+	if _, err := c.Search(es.SearchRequest{}); err == nil {
+		t.Errorf("expected error with no healthy nodes, got none")
+	}
+
+	// After the cooldown, only one of many concurrent requests may probe the
+	// still-failing node; it then goes back out of rotation.
+	time.Sleep(cooldown)
+	atomic.StoreInt32(&requests, 0)
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.Search(es.SearchRequest{})
+		}()
+	}
+	wg.Wait()
+	if expected, got := int32(1), atomic.LoadInt32(&requests); expected != got {
+		t.Errorf("expected %d probe request after cooldown; got %d", expected, got)
+	}
+	if c.Healthy() {
+		t.Errorf("expected node to be excluded after a failed probe")
+	}
+
+	atomic.StoreInt32(&failing, 0)
+	time.Sleep(cooldown)
+
+	if !c.Healthy() {
+		t.Fatalf("expected node to be tried again after cooldown")
+	}
+	if _, err := c.Search(es.SearchRequest{}); err != nil {
+		t.Fatal(err)
+	}
+	if !c.Healthy() {
+		t.Errorf("expected node to be restored after a successful request")
+	}
+}
+
+func TestClientCertificate(t *testing.T) {
+	cert, pool := newClientCertificate(t)
+
+	stub := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/" {
+			return
+		}
+		fmt.Fprint(w, `{"took":1,"hits":{"total":0,"hits":[]}}`)
+	}))
+	stub.TLS = &tls.Config{
+		ClientAuth: tls.RequireAndVerifyClientCert,
+		ClientCAs:  pool,
+	}
+	stub.StartTLS()
+	defer stub.Close()
+
+	serverCAs := x509.NewCertPool()
+	serverCAs.AddCert(stub.Certificate())
+
+	without := es.NewCluster([]string{stub.URL}, time.Minute, time.Second, es.WithTLSConfig(&tls.Config{
+		RootCAs: serverCAs,
+	}))
+	defer without.Shutdown()
+
+	if _, err := without.Search(es.SearchRequest{}); err == nil {
+		t.Errorf("without client certificate: expected error, got none")
+	}
+
+	with := es.NewCluster([]string{stub.URL}, time.Minute, time.Second, es.WithTLSConfig(&tls.Config{
+		RootCAs:      serverCAs,
+		Certificates: []tls.Certificate{cert},
+	}))
+	defer with.Shutdown()
+
+	if err := with.WaitReady(time.Second); err != nil {
+		t.Fatalf("ping with client certificate: %s", err)
+	}
+	if _, err := with.Search(es.SearchRequest{}); err != nil {
+		t.Errorf("search with client certificate: %s", err)
+	}
+}
+
+// newClientCertificate returns a self-signed client certificate, and a pool
+// which trusts it.
+func newClientCertificate(t *testing.T) (tls.Certificate, *x509.CertPool) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "client"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pool := x509.NewCertPool()
+	pool.AddCert(leaf)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}, pool
+}
+
+func TestPingTLS(t *testing.T) {
+	stub := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	}))
+	defer stub.Close()
+
+	if !strings.HasPrefix(stub.URL, "https://") {
+		t.Fatalf("expected https stub; got %s", stub.URL)
+	}
+
+	untrusted := es.NewCluster([]string{stub.URL}, time.Minute, time.Second)
+	defer untrusted.Shutdown()
+
+	if err := untrusted.WaitReady(100 * time.Millisecond); err == nil {
+		t.Errorf("expected ping to fail without trusting the stub's certificate")
+	}
+
+	trusted := es.NewCluster([]string{stub.URL}, time.Minute, time.Second, es.WithTLSConfig(
+		stub.Client().Transport.(*http.Transport).TLSClientConfig,
+	))
+	defer trusted.Shutdown()
+
+	if err := trusted.WaitReady(time.Second); err != nil {
+		t.Errorf("expected ping to succeed with the stub's certificate; got %s", err)
+	}
+}
+
+// chanLogger is a Logger which sends each line to a channel.
+type chanLogger chan string
+
+func (c chanLogger) Printf(format string, args ...interface{}) {
+	c <- fmt.Sprintf(format, args...)
+}
+
+func TestLogger(t *testing.T) {
+	stub := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer stub.Close()
+
+	logger := make(chanLogger, 100)
+	c := es.NewCluster([]string{stub.URL}, time.Minute, time.Second, es.WithLogger(logger))
+	defer c.Shutdown()
+
+	c.WaitReady(10 * time.Millisecond)
+
+	select {
+	case line := <-logger:
+		if !strings.Contains(line, "503") {
+			t.Errorf("expected failed ping to be logged; got %q", line)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("expected failed ping to be logged; got nothing")
+	}
+}
+
+func TestHooks(t *testing.T) {
+	stub := newStub(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/broken") {
+			fmt.Fprint(w, `{"took":`)
+			return
+		}
+		fmt.Fprint(w, `{"took":1,"hits":{"total":0,"hits":[]}}`)
+	})
+	defer stub.Close()
+
+	type call struct {
+		f        es.Fireable
+		endpoint string
+		took     time.Duration
+		err      error
+	}
+	var requests, responses []call
+
+	c := es.NewCluster([]string{stub.URL}, time.Minute, time.Second, es.WithHooks(es.Hooks{
+		OnRequest: func(f es.Fireable, endpoint string) {
+			requests = append(requests, call{f: f, endpoint: endpoint})
+		},
+		OnResponse: func(f es.Fireable, endpoint string, took time.Duration, err error) {
+			responses = append(responses, call{f, endpoint, took, err})
+		},
+	}))
+	defer c.Shutdown()
+
+	good := es.SearchRequest{Params: es.SearchParams{Indices: []string{"good"}}}
+	if _, err := c.Search(good); err != nil {
+		t.Fatal(err)
+	}
+	bad := es.SearchRequest{Params: es.SearchParams{Indices: []string{"broken"}}}
+	if _, err := c.Search(bad); err == nil {
+		t.Fatalf("expected error, got none")
+	}
+
+	if expected, got := 2, len(requests); expected != got {
+		t.Fatalf("expected %d OnRequest call(s); got %d", expected, got)
+	}
+	if expected, got := 2, len(responses); expected != got {
+		t.Fatalf("expected %d OnResponse call(s); got %d", expected, got)
+	}
+
+	for i, expected := range []es.SearchRequest{good, bad} {
+		for _, got := range []call{requests[i], responses[i]} {
+			if got.endpoint != stub.URL {
+				t.Errorf("%d: expected endpoint %q; got %q", i, stub.URL, got.endpoint)
+			}
+			if r, ok := got.f.(es.SearchRequest); !ok || r.Params.Indices[0] != expected.Params.Indices[0] {
+				t.Errorf("%d: expected %v; got %v", i, expected, got.f)
+			}
+		}
+		if responses[i].took <= 0 {
+			t.Errorf("%d: expected positive duration; got %s", i, responses[i].took)
+		}
+	}
+
+	if responses[0].err != nil {
+		t.Errorf("expected no error for the good request; got %s", responses[0].err)
+	}
+	if responses[1].err == nil {
+		t.Errorf("expected an error for the bad request; got none")
+	}
+}
+
+func TestCountViaSearch(t *testing.T) {
+	bodies := make(chan map[string]json.RawMessage, 1)
+	stub := newStub(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]json.RawMessage
+		json.NewDecoder(r.Body).Decode(&body)
+		bodies <- body
+		fmt.Fprint(w, `{"took":1,"hits":{"total":42,"hits":[]}}`)
+	})
+	defer stub.Close()
+
+	c := es.NewCluster([]string{stub.URL}, time.Minute, time.Second)
+	defer c.Shutdown()
+
+	total, err := c.CountViaSearch(es.SearchRequest{
+		Query: map[string]interface{}{
+			"query": es.FieldTerm("user", "kimchy"),
+			"size":  20,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expected, got := 42, total; expected != got {
+		t.Errorf("expected total %d; got %d", expected, got)
+	}
+
+	body := <-bodies
+	if expected, got := `0`, string(body["size"]); expected != got {
+		t.Errorf("expected size = %s; got %s", expected, got)
+	}
+	if _, ok := body["query"]; !ok {
+		t.Errorf("expected query to be sent; got %v", body)
+	}
+}
+
+func TestExecuteOn(t *testing.T) {
+	var hits [2]int32
+	stubs := []*httptest.Server{}
+	for i := range hits {
+		i := i
+		stubs = append(stubs, newStub(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&hits[i], 1)
+			fmt.Fprint(w, `{"took":1,"hits":{"total":0,"hits":[]}}`)
+		}))
+		defer stubs[i].Close()
+	}
+
+	c := es.NewCluster([]string{stubs[0].URL, stubs[1].URL}, time.Minute, time.Second)
+	defer c.Shutdown()
+
+	for i := 0; i < 10; i++ {
+		var response es.SearchResponse
+		if err := c.ExecuteOn(stubs[1].URL, es.SearchRequest{}, &response); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if expected, got := int32(0), atomic.LoadInt32(&hits[0]); expected != got {
+		t.Errorf("expected %d request(s) on the other node; got %d", expected, got)
+	}
+	if expected, got := int32(10), atomic.LoadInt32(&hits[1]); expected != got {
+		t.Errorf("expected %d request(s) on the chosen node; got %d", expected, got)
+	}
+
+	var response es.SearchResponse
+	if err := c.ExecuteOn("http://nonexistent:9200", es.SearchRequest{}, &response); err == nil {
+		t.Errorf("expected error with an unknown endpoint, got none")
+	}
+}
+
+func TestAddRemoveNode(t *testing.T) {
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer down.Close()
+
+	var hits int32
+	up := newStub(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		fmt.Fprint(w, `{"took":1,"hits":{"total":0,"hits":[]}}`)
+	})
+	defer up.Close()
+
+	c := es.NewCluster([]string{down.URL}, 5*time.Millisecond, time.Second)
+	defer c.Shutdown()
+
+	if !waitFor(time.Second, func() bool { return !c.Healthy() }) {
+		t.Fatalf("expected the failing node to be marked unhealthy")
+	}
+
+	if err := c.AddNode(up.URL); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.AddNode(up.URL); err == nil {
+		t.Errorf("expected error adding a duplicate node, got none")
+	}
+
+	time.Sleep(20 * time.Millisecond) // a few pings
+	if _, err := c.Search(es.SearchRequest{}); err != nil {
+		t.Fatalf("search after adding a node: %s", err)
+	}
+	if expected, got := int32(1), atomic.LoadInt32(&hits); expected != got {
+		t.Errorf("expected %d request(s) on the added node; got %d", expected, got)
+	}
+
+	if err := c.RemoveNode(up.URL); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.RemoveNode(up.URL); err == nil {
+		t.Errorf("expected error removing an absent node, got none")
+	}
+
+	if _, err := c.Search(es.SearchRequest{}); err == nil {
+		t.Errorf("expected error searching after removing the only healthy node, got none")
+	}
+}
+
+func TestConcurrentSearchAndAddNode(t *testing.T) {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"took":1,"hits":{"total":0,"hits":[]}}`)
+	}
+	stubs := []*httptest.Server{}
+	for i := 0; i < 4; i++ {
+		stub := newStub(handler)
+		defer stub.Close()
+		stubs = append(stubs, stub)
+	}
+
+	c := es.NewCluster([]string{stubs[0].URL}, 5*time.Millisecond, time.Second)
+	defer c.Shutdown()
+	if err := c.WaitReady(time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				if _, err := c.Search(es.SearchRequest{}); err != nil {
+					t.Errorf("search: %s", err)
+				}
+			}
+		}()
+	}
+	for _, stub := range stubs[1:] {
+		if err := c.AddNode(stub.URL); err != nil {
+			t.Errorf("add node: %s", err)
+		}
+	}
+	wg.Wait()
+}
+
+func TestConcurrentPingAndMembership(t *testing.T) {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"took":1,"hits":{"total":0,"hits":[]}}`)
+	}
+	first, second := newStub(handler), newStub(handler)
+	defer first.Close()
+	defer second.Close()
+
+	c := es.NewCluster([]string{first.URL}, time.Millisecond, time.Second)
+	defer c.Shutdown()
+
+	var wg sync.WaitGroup
+	run := func(f func()) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 20; i++ {
+				f()
+			}
+		}()
+	}
+	run(func() { c.WaitReady(time.Second) })
+	run(func() { c.Healthy() })
+	run(func() { c.Search(es.SearchRequest{}) })
+	run(func() {
+		if err := c.AddNode(second.URL); err != nil {
+			t.Errorf("add node: %s", err)
+		}
+		if err := c.RemoveNode(second.URL); err != nil {
+			t.Errorf("remove node: %s", err)
+		}
+	})
+	wg.Wait()
+
+	if !c.Healthy() {
+		t.Errorf("expected cluster to be healthy")
+	}
+}
+
+func TestPingBackoff(t *testing.T) {
+	var (
+		mtx   sync.Mutex
+		pings []time.Time
+	)
+	stub := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mtx.Lock()
+		defer mtx.Unlock()
+		pings = append(pings, time.Now())
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer stub.Close()
+
+	c := es.NewCluster([]string{stub.URL}, 10*time.Millisecond, time.Second)
+	defer c.Shutdown()
+
+	if !waitFor(2*time.Second, func() bool {
+		mtx.Lock()
+		defer mtx.Unlock()
+		return len(pings) >= 5
+	}) {
+		t.Fatalf("expected at least 5 pings")
+	}
+
+	mtx.Lock()
+	defer mtx.Unlock()
+	for i := 2; i < len(pings); i++ {
+		prev, next := pings[i-1].Sub(pings[i-2]), pings[i].Sub(pings[i-1])
+		if next <= prev {
+			t.Errorf("expected growing intervals between failed pings; got %s then %s", prev, next)
+		}
+	}
+}
+
+func TestPingPath(t *testing.T) {
+	stub := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			fmt.Fprint(w, `{"version":{"number":"7.10.2"}}`)
+		case "/_cluster/health":
+			fmt.Fprint(w, `{"status":"red"}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer stub.Close()
+
+	if !es.NewNode(stub.URL, time.Second).Ping() {
+		t.Errorf("expected default ping of / to succeed")
+	}
+
+	c := es.NewCluster([]string{stub.URL}, time.Minute, time.Second, es.WithPing("/_cluster/nodes/_local", nil))
+	defer c.Shutdown()
+	if err := c.WaitReady(50 * time.Millisecond); err == nil {
+		t.Errorf("expected ping of a missing path to fail")
+	}
+
+	notRed := func(resp *http.Response) bool {
+		var health struct {
+			Status string `json:"status"`
+		}
+		return json.NewDecoder(resp.Body).Decode(&health) == nil && health.Status != "red"
+	}
+	c = es.NewCluster([]string{stub.URL}, time.Minute, time.Second, es.WithPing("/_cluster/health", notRed))
+	defer c.Shutdown()
+	if err := c.WaitReady(50 * time.Millisecond); err == nil {
+		t.Errorf("expected ping to fail the custom predicate")
+	}
+}
+
+func TestNodeVersion(t *testing.T) {
+	stub := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"name":"es001","cluster_name":"logs","version":{"number":"6.8.23","lucene_version":"7.7.3"},"tagline":"You Know, for Search"}`)
+	}))
+	defer stub.Close()
+
+	n := es.NewNode(stub.URL, time.Second)
+	if expected, got := "", n.Version(); expected != got {
+		t.Errorf("expected Version() = %q before a ping; got %q", expected, got)
+	}
+
+	if !n.Ping() {
+		t.Fatalf("expected ping to succeed")
+	}
+	if expected, got := "6.8.23", n.Version(); expected != got {
+		t.Errorf("expected Version() = %q; got %q", expected, got)
+	}
+	if expected, got := "logs", n.ClusterName(); expected != got {
+		t.Errorf("expected ClusterName() = %q; got %q", expected, got)
+	}
+}
+
+func TestServerVersion(t *testing.T) {
+	newVersionStub := func(version string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/" {
+				fmt.Fprintf(w, `{"version":{"number":%q}}`, version)
+				return
+			}
+
+			var body struct {
+				TrackTotalHits *bool `json:"track_total_hits"`
+			}
+			json.NewDecoder(r.Body).Decode(&body)
+			switch {
+			case strings.HasPrefix(version, "6."): // hits.total is a number
+				fmt.Fprint(w, `{"took":1,"hits":{"total":12345,"hits":[]}}`)
+			case body.TrackTotalHits != nil && *body.TrackTotalHits:
+				fmt.Fprint(w, `{"took":1,"hits":{"total":{"value":12345,"relation":"eq"},"hits":[]}}`)
+			default:
+				fmt.Fprint(w, `{"took":1,"hits":{"total":{"value":10000,"relation":"gte"},"hits":[]}}`)
+			}
+		}))
+	}
+
+	for _, version := range []string{"6.8.23", "7.10.2"} {
+		stub := newVersionStub(version)
+		defer stub.Close()
+
+		c := es.NewCluster([]string{stub.URL}, time.Minute, time.Second)
+		defer c.Shutdown()
+
+		if expected, got := "", c.ServerVersion(); expected != got {
+			t.Errorf("expected ServerVersion() = %q before a ping; got %q", expected, got)
+		}
+		if err := c.WaitReady(time.Second); err != nil {
+			t.Fatal(err)
+		}
+		if expected, got := version, c.ServerVersion(); expected != got {
+			t.Errorf("expected ServerVersion() = %q; got %q", expected, got)
+		}
+
+		count, err := c.CountViaSearch(es.SearchRequest{})
+		if err != nil {
+			t.Fatalf("%s: %s", version, err)
+		}
+		if expected, got := 12345, count; expected != got {
+			t.Errorf("%s: expected count %d; got %d", version, expected, got)
+		}
+	}
+
+	old, current := newVersionStub("6.8.23"), newVersionStub("7.10.2")
+	defer old.Close()
+	defer current.Close()
+
+	c := es.NewCluster([]string{current.URL, old.URL}, time.Minute, time.Second)
+	defer c.Shutdown()
+	if err := c.WaitReady(time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if expected, got := "6.8.23", c.ServerVersion(); expected != got {
+		t.Errorf("expected ServerVersion() = %q, the lowest; got %q", expected, got)
+	}
+}
+
+func TestBulkParallel(t *testing.T) {
+	var inFlight, maxInFlight int32
+	stub := newStub(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&inFlight, 1)
+		defer atomic.AddInt32(&inFlight, -1)
+		for {
+			max := atomic.LoadInt32(&maxInFlight)
+			if n <= max || atomic.CompareAndSwapInt32(&maxInFlight, max, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+
+		// Echo the id of the batch's only document.
+		var header struct {
+			Index struct {
+				Id string `json:"_id"`
+			} `json:"index"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&header); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if header.Index.Id == "fail" {
+			fmt.Fprint(w, `{"took":`)
+			return
+		}
+		fmt.Fprintf(w, `{"took":1,"items":[{"index":{"_id":%q,"ok":true}}]}`, header.Index.Id)
+	})
+	defer stub.Close()
+
+	c := es.NewCluster([]string{stub.URL}, time.Minute, time.Second)
+	defer c.Shutdown()
+
+	ids := []string{"1", "2", "3", "fail", "5", "6", "7"}
+	batches := [][]es.BulkIndexable{}
+	for _, id := range ids {
+		batches = append(batches, []es.BulkIndexable{es.IndexRequest{
+			Params: es.IndexParams{Index: "twitter", Type: "tweet", Id: id},
+			Source: map[string]string{"user": "kimchy"},
+		}})
+	}
+
+	responses, errs := c.BulkParallel(batches, 3)
+	if expected, got := len(batches), len(responses); expected != got {
+		t.Fatalf("expected %d responses; got %d", expected, got)
+	}
+	for i, id := range ids {
+		if id == "fail" {
+			if errs[i] == nil {
+				t.Errorf("batch %d: expected error, got none", i)
+			}
+			continue
+		}
+		if errs[i] != nil {
+			t.Errorf("batch %d: %s", i, errs[i])
+			continue
+		}
+		if expected, got := id, responses[i].Items[0].ID; expected != got {
+			t.Errorf("batch %d: expected item _id %q; got %q", i, expected, got)
+		}
+	}
+
+	if expected, got := int32(3), atomic.LoadInt32(&maxInFlight); expected != got {
+		t.Errorf("expected %d batches in flight at most; got %d", expected, got)
+	}
+}
+
+func TestWaitReadyIgnoresPingBackoff(t *testing.T) {
+	var pings, healthy int32
+	stub := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&pings, 1)
+		if atomic.LoadInt32(&healthy) != 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer stub.Close()
+
+	c := es.NewCluster([]string{stub.URL}, 20*time.Millisecond, time.Second)
+	defer c.Shutdown()
+
+	// After 5 failed pings, the node is pinged every 32 intervals, ie. 640ms.
+	if !waitFor(2*time.Second, func() bool { return atomic.LoadInt32(&pings) >= 5 }) {
+		t.Fatalf("expected at least 5 pings")
+	}
+	atomic.StoreInt32(&healthy, 1)
+
+	if err := c.WaitReady(200 * time.Millisecond); err != nil {
+		t.Fatalf("expected WaitReady to ping the node despite its backoff; got %s", err)
+	}
+
+	// WaitReady shouldn't have reset or counted down the backoff.
+	before := atomic.LoadInt32(&pings)
+	time.Sleep(200 * time.Millisecond)
+	if expected, got := before, atomic.LoadInt32(&pings); expected != got {
+		t.Errorf("expected no scheduled pings while backing off; got %d", got-expected)
+	}
+}
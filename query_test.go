@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	es "github.com/peterbourgon/elasticsearch"
+	"testing"
 )
 
 func marshalOrError(q es.SubQuery) string {
@@ -27,3 +28,471 @@ func ExampleBasicTermQuery() {
 	// Output:
 	// {"term":{"user":"kimchy"}}
 }
+
+// http://www.elasticsearch.org/guide/reference/api/search/aggregations/
+func ExampleAggregations() {
+	aggs := es.Aggregations{
+		{
+			Name: "users",
+			Agg:  es.TermsAgg(es.TermsAggParams{Field: "user", Size: 10}),
+			Aggs: es.Aggregations{
+				{
+					Name: "per_day",
+					Agg: es.DateHistogramAgg(es.DateHistogramAggParams{
+						Field:    "post_date",
+						Interval: "day",
+					}),
+				},
+				{
+					Name: "retweets",
+					Agg:  es.StatsAgg(es.StatsAggParams{Field: "retweets"}),
+				},
+			},
+		},
+	}
+
+	fmt.Print(marshalOrError(aggs))
+	// Output:
+	// {"users":{"aggs":{"per_day":{"date_histogram":{"field":"post_date","interval":"day"}},"retweets":{"stats":{"field":"retweets"}}},"terms":{"field":"user","size":10}}}
+}
+
+// http://www.elasticsearch.org/guide/reference/api/search/aggregations/bucket/range-aggregation/
+func ExampleRangeAgg() {
+	fifty, hundred := 50.0, 100.0
+	aggs := es.Aggregations{
+		{
+			Name: "price_ranges",
+			Agg: es.RangeAgg(es.RangeAggParams{
+				Field: "price",
+				Ranges: []es.AggRange{
+					{To: &fifty},
+					{From: &fifty, To: &hundred},
+					{From: &hundred},
+				},
+			}),
+		},
+	}
+
+	fmt.Print(marshalOrError(aggs))
+	// Output:
+	// {"price_ranges":{"range":{"field":"price","ranges":[{"to":50},{"from":50,"to":100},{"from":100}]}}}
+}
+
+// http://www.elasticsearch.org/guide/reference/query-dsl/filtered-query.html
+func ExampleFilteredQuery() {
+	q := es.FilteredQuery(es.FilteredQueryParams{
+		Query: es.MatchQuery(es.MatchQueryParams{
+			Query: &es.Wrapper{
+				Name:    "message",
+				Wrapped: "trying out",
+			},
+		}),
+		Filter: es.TermFilter(es.TermFilterParams{
+			Field: "user",
+			Value: "kimchy",
+		}),
+	})
+
+	fmt.Print(marshalOrError(q))
+	// Output:
+	// {"filtered":{"query":{"match":{"message":"trying out"}},"filter":{"term":{"user":"kimchy"}}}}
+}
+
+func ExampleFilteredQuery_filterOnly() {
+	q := es.FilteredQuery(es.FilteredQueryParams{
+		Filter: es.TermFilter(es.TermFilterParams{
+			Field: "user",
+			Value: "kimchy",
+		}),
+	})
+
+	fmt.Print(marshalOrError(q))
+	// Output:
+	// {"filtered":{"filter":{"term":{"user":"kimchy"}}}}
+}
+
+// http://www.elasticsearch.org/guide/reference/query-dsl/bool-filter.html
+func ExampleBoolFilter() {
+	q := es.BoolFilter(es.BoolFilterParams{
+		Must: []es.FilterSubQuery{
+			es.TermFilter(es.TermFilterParams{Field: "user", Value: "kimchy"}),
+		},
+		MustNot: []es.FilterSubQuery{
+			es.TermFilter(es.TermFilterParams{Field: "tag", Value: "spam"}),
+			es.TermFilter(es.TermFilterParams{Field: "tag", Value: "nsfw"}),
+		},
+	})
+
+	fmt.Print(marshalOrError(q))
+	// Output:
+	// {"bool":{"must":[{"term":{"user":"kimchy"}}],"must_not":[{"term":{"tag":"spam"}},{"term":{"tag":"nsfw"}}]}}
+}
+
+// http://www.elasticsearch.org/guide/reference/query-dsl/bool-query.html
+func ExampleClauses() {
+	user := es.TermQuery(es.TermQueryParams{
+		Query: &es.Wrapper{Name: "user", Wrapped: "kimchy"},
+	})
+	tag := es.TermQuery(es.TermQueryParams{
+		Query: &es.Wrapper{Name: "tag", Wrapped: "wow"},
+	})
+
+	q := es.BoolQuery(es.BoolQueryParams{
+		Must:   es.Clauses(user),
+		Should: es.Clauses(user, tag),
+	})
+
+	fmt.Print(marshalOrError(q))
+	// Output:
+	// {"bool":{"must":{"term":{"user":"kimchy"}},"should":[{"term":{"user":"kimchy"}},{"term":{"tag":"wow"}}]}}
+}
+
+func ExampleClauses_single() {
+	user := es.TermQuery(es.TermQueryParams{
+		Query: &es.Wrapper{Name: "user", Wrapped: "kimchy"},
+	})
+
+	fmt.Println(marshalOrError(es.BoolQuery(es.BoolQueryParams{Must: user})))
+	fmt.Println(marshalOrError(es.BoolQuery(es.BoolQueryParams{Must: es.Clauses(user)})))
+	fmt.Println(marshalOrError(es.BoolQuery(es.BoolQueryParams{Must: es.Clauses()})))
+	// Output:
+	// {"bool":{"must":{"term":{"user":"kimchy"}}}}
+	// {"bool":{"must":{"term":{"user":"kimchy"}}}}
+	// {"bool":{}}
+}
+
+// http://www.elasticsearch.org/guide/reference/query-dsl/range-filter.html
+func ExampleRangeFilter() {
+	fmt.Println(marshalOrError(es.RangeFilter(es.FieldedRange("age", es.RangeParams{
+		GTE: "18",
+		LT:  "65",
+	}))))
+	fmt.Println(marshalOrError(es.RangeFilter(es.FieldedRangeSubQuery("age", es.RangeFilterParams{
+		From:         "18",
+		To:           "65",
+		IncludeLower: true,
+	}))))
+	// Output:
+	// {"range":{"age":{"gte":"18","lt":"65"}}}
+	// {"range":{"age":{"from":"18","to":"65","include_lower":true,"include_upper":false}}}
+}
+
+// http://www.elasticsearch.org/guide/reference/query-dsl/range-query.html
+func ExampleRangeQuery() {
+	q := es.RangeQuery(es.FieldedRange("age", es.RangeParams{
+		GT:  "18",
+		LTE: "65",
+	}))
+
+	fmt.Print(marshalOrError(q))
+	// Output:
+	// {"range":{"age":{"gt":"18","lte":"65"}}}
+}
+
+func ExampleRangeFilter_dates() {
+	fmt.Println(marshalOrError(es.RangeFilter(es.FieldedRange("post_date", es.RangeParams{
+		GTE:      "2009-11-15",
+		LT:       "2009-11-16",
+		Format:   "yyyy-MM-dd",
+		TimeZone: "+01:00",
+	}))))
+	fmt.Println(marshalOrError(es.RangeFilter(es.FieldedRangeSubQuery("post_date", es.RangeFilterParams{
+		From:         "2009-11-15",
+		To:           "2009-11-16",
+		IncludeLower: true,
+		Format:       "yyyy-MM-dd",
+		TimeZone:     "+01:00",
+	}))))
+	// Output:
+	// {"range":{"post_date":{"gte":"2009-11-15","lt":"2009-11-16","format":"yyyy-MM-dd","time_zone":"+01:00"}}}
+	// {"range":{"post_date":{"from":"2009-11-15","to":"2009-11-16","include_lower":true,"include_upper":false,"format":"yyyy-MM-dd","time_zone":"+01:00"}}}
+}
+
+// http://www.elasticsearch.org/guide/reference/query-dsl/span-near-query.html
+func ExampleSpanNearQuery() {
+	q := es.SpanNearQuery(es.SpanNearQueryParams{
+		Clauses: []es.SubQuery{
+			es.SpanTermQuery("field", "value1"),
+			es.SpanTermQuery("field", "value2"),
+			es.SpanTermQuery("field", "value3"),
+		},
+		Slop:    12,
+		InOrder: false,
+	})
+
+	fmt.Print(marshalOrError(q))
+	// Output:
+	// {"span_near":{"clauses":[{"span_term":{"field":"value1"}},{"span_term":{"field":"value2"}},{"span_term":{"field":"value3"}}],"slop":12,"in_order":false}}
+}
+
+// http://www.elasticsearch.org/guide/reference/query-dsl/span-or-query.html
+func ExampleSpanOrQuery() {
+	q := es.SpanOrQuery([]es.SubQuery{
+		es.SpanTermQuery("field", "value1"),
+		es.SpanTermQuery("field", "value2"),
+	})
+
+	fmt.Print(marshalOrError(q))
+	// Output:
+	// {"span_or":{"clauses":[{"span_term":{"field":"value1"}},{"span_term":{"field":"value2"}}]}}
+}
+
+// http://www.elasticsearch.org/guide/reference/query-dsl/span-not-query.html
+func ExampleSpanNotQuery() {
+	q := es.SpanNotQuery(es.SpanNotQueryParams{
+		Include: es.SpanTermQuery("field1", "hoya"),
+		Exclude: es.SpanNearQuery(es.SpanNearQueryParams{
+			Clauses: []es.SubQuery{
+				es.SpanTermQuery("field1", "la"),
+				es.SpanTermQuery("field1", "hoya"),
+			},
+			Slop:    0,
+			InOrder: true,
+		}),
+	})
+
+	fmt.Print(marshalOrError(q))
+	// Output:
+	// {"span_not":{"include":{"span_term":{"field1":"hoya"}},"exclude":{"span_near":{"clauses":[{"span_term":{"field1":"la"}},{"span_term":{"field1":"hoya"}}],"slop":0,"in_order":true}}}}
+}
+
+// http://www.elasticsearch.org/guide/reference/query-dsl/common-terms-query.html
+func ExampleCommonTermsQuery() {
+	q := es.CommonTermsQuery("body", es.CommonTermsQueryParams{
+		Query:            "nelly the elephant as a cartoon",
+		CutoffFrequency:  0.001,
+		LowFreqOperator:  "and",
+		HighFreqOperator: "or",
+	})
+
+	fmt.Print(marshalOrError(q))
+	// Output:
+	// {"common":{"body":{"query":"nelly the elephant as a cartoon","cutoff_frequency":0.001,"low_freq_operator":"and","high_freq_operator":"or"}}}
+}
+
+// http://www.elasticsearch.org/guide/reference/query-dsl/indices-query.html
+func ExampleIndicesQuery() {
+	q := es.IndicesQuery(es.IndicesQueryParams{
+		Indices: []string{"index1", "index2"},
+		Query: es.TermQuery(es.TermQueryParams{
+			Query: &es.Wrapper{Name: "tag", Wrapped: "wow"},
+		}),
+		NoMatchQuery: "none",
+	})
+
+	fmt.Print(marshalOrError(q))
+	// Output:
+	// {"indices":{"indices":["index1","index2"],"query":{"term":{"tag":"wow"}},"no_match_query":"none"}}
+}
+
+// http://www.elasticsearch.org/guide/reference/query-dsl/indices-filter.html
+func ExampleIndicesFilter() {
+	q := es.IndicesFilter(es.IndicesFilterParams{
+		Indices:       []string{"index1", "index2"},
+		Filter:        es.TermFilter(es.TermFilterParams{Field: "tag", Value: "wow"}),
+		NoMatchFilter: es.TermFilter(es.TermFilterParams{Field: "tag", Value: "kow"}),
+	})
+
+	fmt.Print(marshalOrError(q))
+	// Output:
+	// {"indices":{"indices":["index1","index2"],"filter":{"term":{"tag":"wow"}},"no_match_filter":{"term":{"tag":"kow"}}}}
+}
+
+// http://www.elasticsearch.org/guide/reference/query-dsl/type-filter.html
+func ExampleTypeFilter() {
+	q := es.BooleanFilters(es.BooleanFiltersParams{
+		AndFilters: []es.FilterSubQuery{
+			es.TypeFilter("tweet"),
+		},
+	})
+
+	fmt.Print(marshalOrError(q))
+	// Output:
+	// {"and":[{"type":{"value":"tweet"}}]}
+}
+
+// http://www.elasticsearch.org/guide/reference/query-dsl/match-query.html
+func ExampleFieldMatch() {
+	manual := es.MatchQuery(es.MatchQueryParams{
+		Query: &es.Wrapper{
+			Name:    "message",
+			Wrapped: "this is a test",
+		},
+	})
+
+	fmt.Println(marshalOrError(es.FieldMatch("message", "this is a test")))
+	fmt.Println(marshalOrError(manual))
+	// Output:
+	// {"match":{"message":"this is a test"}}
+	// {"match":{"message":"this is a test"}}
+}
+
+// http://www.elasticsearch.org/guide/reference/query-dsl/term-query.html
+func ExampleFieldTerm() {
+	manual := es.TermQuery(es.TermQueryParams{
+		Query: &es.Wrapper{
+			Name:    "user",
+			Wrapped: "kimchy",
+		},
+	})
+
+	fmt.Println(marshalOrError(es.FieldTerm("user", "kimchy")))
+	fmt.Println(marshalOrError(manual))
+	// Output:
+	// {"term":{"user":"kimchy"}}
+	// {"term":{"user":"kimchy"}}
+}
+
+func ExampleTermQuery_boost() {
+	q := es.TermQuery(es.TermQueryParams{
+		Query: &es.Wrapper{
+			Name:    "user",
+			Wrapped: "kimchy",
+		},
+		Boost: 2,
+	})
+
+	fmt.Println(marshalOrError(q))
+	fmt.Println(marshalOrError(es.FieldTerm("user", "kimchy")))
+	// Output:
+	// {"term":{"user":{"boost":2,"value":"kimchy"}}}
+	// {"term":{"user":"kimchy"}}
+}
+
+func ExampleBoolQuery_minimumShouldMatch() {
+	should := es.Clauses(es.FieldTerm("tag", "wow"), es.FieldTerm("tag", "elasticsearch"))
+
+	fmt.Println(marshalOrError(es.BoolQuery(es.BoolQueryParams{
+		Should:                   should,
+		MinimumNumberShouldMatch: 1,
+	})))
+	fmt.Println(marshalOrError(es.BoolQuery(es.BoolQueryParams{
+		Should:                   should,
+		MinimumNumberShouldMatch: 1,
+		MinimumShouldMatch:       "75%",
+	})))
+	// Output:
+	// {"bool":{"should":[{"term":{"tag":"wow"}},{"term":{"tag":"elasticsearch"}}],"minimum_number_should_match":1}}
+	// {"bool":{"should":[{"term":{"tag":"wow"}},{"term":{"tag":"elasticsearch"}}],"minimum_should_match":"75%"}}
+}
+
+// http://www.elasticsearch.org/guide/reference/query-dsl/dis-max-query.html
+func ExampleMultiFieldDisMax() {
+	q := es.MultiFieldDisMax("elastic search", []string{"title", "body"}, 0.3)
+
+	fmt.Print(marshalOrError(q))
+	// Output:
+	// {"dis_max":{"queries":[{"match":{"title":"elastic search"}},{"match":{"body":"elastic search"}}],"tie_breaker":0.3}}
+}
+
+func ExampleMatchPhrasePrefixQuery() {
+	fmt.Println(marshalOrError(es.MatchPhrasePrefixQuery("message", es.MatchPhrasePrefixQueryParams{
+		Query:         "this is a t",
+		MaxExpansions: 10,
+	})))
+	fmt.Println(marshalOrError(es.MatchPhrasePrefixQuery("message", es.MatchPhrasePrefixQueryParams{
+		Query: "this is a t",
+	})))
+	// Output:
+	// {"match_phrase_prefix":{"message":{"query":"this is a t","max_expansions":10}}}
+	// {"match_phrase_prefix":{"message":{"query":"this is a t"}}}
+}
+
+// http://www.elasticsearch.org/guide/reference/api/search/facets/geo-distance-facet.html
+func ExampleGeoDistanceFacet() {
+	f := es.NamedFacet("rings", es.GeoDistanceFacet(es.GeoDistanceFacetParams{
+		Field: "pin.location",
+		Lat:   40,
+		Lon:   -70,
+		Unit:  "km",
+		Ranges: []es.DistanceRange{
+			{To: 10},
+			{From: 10, To: 20},
+			{From: 20},
+		},
+	}))
+
+	fmt.Print(marshalOrError(f))
+	// Output:
+	// {"rings":{"geo_distance":{"pin.location":{"lat":40,"lon":-70},"ranges":[{"to":10},{"from":10,"to":20},{"from":20}],"unit":"km"}}}
+}
+
+// http://www.elasticsearch.org/guide/reference/query-dsl/query-string-query.html
+func ExampleQueryStringQuery() {
+	q := es.QueryStringQuery(es.QueryStringQueryParams{
+		Query:        es.EscapeQueryString("(1+1):2"),
+		DefaultField: "content",
+	})
+
+	fmt.Print(marshalOrError(q))
+	// Output:
+	// {"query_string":{"query":"\\(1\\+1\\)\\:2","default_field":"content"}}
+}
+
+func TestEscapeQueryString(t *testing.T) {
+	for _, tuple := range []struct {
+		s, expected string
+	}{
+		{`plain text`, `plain text`},
+		{`+`, `\+`},
+		{`-`, `\-`},
+		{`&&`, `\&\&`},
+		{`||`, `\|\|`},
+		{`!`, `\!`},
+		{`(`, `\(`},
+		{`)`, `\)`},
+		{`{`, `\{`},
+		{`}`, `\}`},
+		{`[`, `\[`},
+		{`]`, `\]`},
+		{`^`, `\^`},
+		{`"`, `\"`},
+		{`~`, `\~`},
+		{`*`, `\*`},
+		{`?`, `\?`},
+		{`:`, `\:`},
+		{`\`, `\\`},
+		{`/`, `\/`},
+		{`title:"foo bar" AND body:(baz)`, `title\:\"foo bar\" AND body\:\(baz\)`},
+	} {
+		if expected, got := tuple.expected, es.EscapeQueryString(tuple.s); expected != got {
+			t.Errorf("%q: expected %q; got %q", tuple.s, expected, got)
+		}
+	}
+}
+
+// http://www.elasticsearch.org/guide/reference/query-dsl/match-query.html
+func ExampleFieldMatchAdvanced() {
+	q := es.FieldMatchAdvanced("message", es.GenericQueryParams{
+		Query:     "this is a test",
+		Operator:  "and",
+		Fuzziness: "AUTO",
+	})
+
+	fmt.Print(marshalOrError(q))
+	// Output:
+	// {"match":{"message":{"query":"this is a test","operator":"and","fuzziness":"AUTO"}}}
+}
+
+// http://www.elasticsearch.org/guide/reference/query-dsl/match-all-query.html
+func ExampleMatchAllQueryBoosted() {
+	fmt.Println(marshalOrError(es.MatchAllQuery()))
+	fmt.Println(marshalOrError(es.MatchAllQueryBoosted(2)))
+	fmt.Println(marshalOrError(es.MatchAllQueryBoosted(1.5)))
+	// Output:
+	// {"match_all":{}}
+	// {"match_all":{"boost":2}}
+	// {"match_all":{"boost":1.5}}
+}
+
+func ExampleSearchWithFilters() {
+	q := es.SearchWithFilters(
+		es.FieldMatch("message", "elasticsearch"),
+		es.TermFilter(es.TermFilterParams{Field: "user", Value: "kimchy"}),
+		es.TermFilter(es.TermFilterParams{Field: "tag", Value: "wow"}),
+	)
+
+	fmt.Print(marshalOrError(q))
+	// Output:
+	// {"filtered":{"query":{"match":{"message":"elasticsearch"}},"filter":{"bool":{"must":[{"term":{"user":"kimchy"}},{"term":{"tag":"wow"}}]}}}}
+}
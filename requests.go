@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"net/url"
 	"strings"
@@ -23,15 +24,99 @@ func values(v map[string]string) url.Values {
 	return values
 }
 
+// Content types of request bodies. Bulk and multi-search bodies are made of
+// newline-delimited JSON objects; everything else is a single JSON object.
+const (
+	contentTypeJSON   = "application/json"
+	contentTypeNDJSON = "application/x-ndjson"
+)
+
+// newRequest is like http.NewRequest, but also sets the Content-Type of the
+// body.
+func newRequest(method, uri, contentType string, body io.Reader) (*http.Request, error) {
+	request, err := http.NewRequest(method, uri, body)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Content-Type", contentType)
+	return request, nil
+}
+
 // Fireable defines anything which can be fired against the search cluster.
 type Fireable interface {
 	Request(uri *url.URL) (*http.Request, error)
 }
 
+// RawRequest is a Fireable for endpoints that don't (yet) have first-class
+// support. Method, Path, Query and Body are passed through unchanged. A Body
+// is assumed to be JSON.
+type RawRequest struct {
+	Method string
+	Path   string
+	Query  url.Values
+	Body   io.Reader
+}
+
+func (r RawRequest) Request(uri *url.URL) (*http.Request, error) {
+	uri.Path = r.Path
+	uri.RawQuery = r.Query.Encode()
+
+	if r.Body == nil {
+		return http.NewRequest(r.Method, uri.String(), nil)
+	}
+	return newRequest(r.Method, uri.String(), contentTypeJSON, r.Body)
+}
+
 //
 //
 //
 
+// Values for the SearchType of SearchParams and MultiSearchParams.
+// http://www.elasticsearch.org/guide/reference/api/search/search-type/
+const (
+	SearchTypeQueryThenFetch    = "query_then_fetch"
+	SearchTypeQueryAndFetch     = "query_and_fetch"
+	SearchTypeDfsQueryThenFetch = "dfs_query_then_fetch"
+	SearchTypeDfsQueryAndFetch  = "dfs_query_and_fetch"
+	SearchTypeCount             = "count"
+	SearchTypeScan              = "scan"
+)
+
+// validateSearchType returns an error if the search type isn't empty or one
+// of the SearchType constants.
+func validateSearchType(searchType string) error {
+	switch searchType {
+	case "",
+		SearchTypeQueryThenFetch,
+		SearchTypeQueryAndFetch,
+		SearchTypeDfsQueryThenFetch,
+		SearchTypeDfsQueryAndFetch,
+		SearchTypeCount,
+		SearchTypeScan:
+		return nil
+	}
+	return fmt.Errorf("invalid search type %q", searchType)
+}
+
+// Values for the Preference of SearchParams. Those ending in a colon are
+// prefixes, to be followed by a comma-separated list of node IDs or shards.
+// http://www.elasticsearch.org/guide/reference/api/search/preference/
+const (
+	PreferencePrimary      = "_primary"
+	PreferencePrimaryFirst = "_primary_first"
+	PreferenceLocal        = "_local"
+	PreferenceOnlyNodes    = "_only_nodes:"
+	PreferencePreferNodes  = "_prefer_nodes:"
+	PreferenceShards       = "_shards:"
+)
+
+// PreferCustom returns a Preference which routes searches with the same key,
+// eg. a user's session ID, to the same shard copies. Leading underscores are
+// removed, as they're reserved for the special values.
+func PreferCustom(key string) string {
+	return strings.TrimLeft(key, "_")
+}
+
 type SearchParams struct {
 	Indices []string `json:"index,omitempty"`
 	Types   []string `json:"type,omitempty"`
@@ -39,6 +124,33 @@ type SearchParams struct {
 	Routing    string `json:"routing,omitempty"`
 	Preference string `json:"preference,omitempty"`
 	SearchType string `json:"search_type,omitempty"`
+
+	// Parent routes the search to the shard holding the parent's children.
+	// It's not valid in a multi-search header, so it's not marshaled.
+	Parent string `json:"-"`
+}
+
+// Validate returns an error if the params would produce an invalid request.
+// That includes index and type names which would make the path ambiguous.
+func (p SearchParams) Validate() error {
+	if err := validateNames("index", p.Indices); err != nil {
+		return err
+	}
+	if err := validateNames("type", p.Types); err != nil {
+		return err
+	}
+	return validateSearchType(p.SearchType)
+}
+
+// validateNames returns an error if any of the names can't be used as one
+// element of a comma-separated list in a path segment.
+func validateNames(kind string, names []string) error {
+	for _, name := range names {
+		if name == "" || strings.ContainsAny(name, ",/") {
+			return fmt.Errorf("invalid %s name %q", kind, name)
+		}
+	}
+	return nil
 }
 
 func (p SearchParams) Values() url.Values {
@@ -46,60 +158,434 @@ func (p SearchParams) Values() url.Values {
 		"routing":     p.Routing,
 		"preference":  p.Preference,
 		"search_type": p.SearchType,
+		"parent":      p.Parent,
 	})
 }
 
 type SearchRequest struct {
 	Params SearchParams
 	Query  SubQuery
+
+	Aggregations Aggregations
+	Suggest      Suggest
+
+	// SourceFilter restricts the parts of each hit's _source that are
+	// returned. SourceFields is a shortcut for the common case of only
+	// including some fields; if both are set, SourceFilter wins.
+	SourceFilter *SourceFilter
+	SourceFields []string
+
+	Highlight *HighlightConfig
+
+	// StoredFields selects stored fields to be returned in each Hit's Fields.
+	StoredFields []string
+
+	// ScriptFields are computed for each hit, and returned in its Fields,
+	// under the same names.
+	ScriptFields map[string]ScriptField
+
+	// MinScore excludes hits scoring below it. It's a pointer, so that an
+	// explicit zero can be distinguished from unset.
+	MinScore *float64
+
+	// PostFilter is applied to the hits after aggregations are computed.
+	PostFilter FilterSubQuery
+
+	// IndicesBoost multiplies the scores of hits from each named index.
+	IndicesBoost map[string]float32
+
+	// Rescore re-ranks the top hits of each shard with a further query.
+	Rescore *Rescore
+
+	// Sort orders the hits by each clause in turn. By default, hits are
+	// ordered by score.
+	Sort []SortClause
+
+	// TrackScores computes scores even when sorting by something else.
+	// TrackTotalHits is a pointer, so that an explicit false can be sent.
+	TrackScores    bool
+	TrackTotalHits *bool
+
+	// SearchAfter pages through the hits by returning those which sort after
+	// the given values. It requires a Sort, and is typically the Sort values
+	// of the last Hit of the previous page.
+	SearchAfter []interface{}
+
+	// Timeout (eg. "500ms") and TerminateAfter (a number of documents per
+	// shard) bound the work done by the search. Either limit being reached
+	// is reported in the SearchResponse, via TimedOut or TerminatedEarly.
+	Timeout        string
+	TerminateAfter int
+
+	// Explain and Version request each Hit's Explanation and Version.
+	Explain bool
+	Version bool
+
+	// Extra is merged into the top level of the request body, alongside
+	// whatever Query marshals to. It's an escape hatch for parts of the
+	// search body that don't (yet) have first-class support. On collision,
+	// keys set by Query or explicit fields win.
+	Extra map[string]interface{}
 }
 
 func (r SearchRequest) EncodeMultiHeader(enc *json.Encoder) error {
 	return enc.Encode(r.Params)
 }
 
+// EncodeQuery writes the request body. An empty body, which can't be omitted
+// in a multi-search, is written as `{}` rather than `null`.
 func (r SearchRequest) EncodeQuery(enc *json.Encoder) error {
-	return enc.Encode(r.Query)
+	body, err := r.body()
+	if err != nil {
+		return err
+	}
+	if body == nil {
+		body = map[string]interface{}{} // render to '{}'
+	}
+	return enc.Encode(body)
+}
+
+// body returns the structure that should be marshaled as the request body.
+// If there's nothing to merge, that's just the Query. Otherwise, the Query
+// must marshal to a JSON object, and Extra, the Query, and the explicit fields
+// are merged, in that order, into a single object.
+func (r SearchRequest) body() (interface{}, error) {
+	fields := r.fields()
+	if len(r.Extra) <= 0 && len(fields) <= 0 {
+		return r.Query, nil
+	}
+
+	body := map[string]interface{}{}
+	for key, value := range r.Extra {
+		body[key] = value
+	}
+
+	if r.Query != nil {
+		query, err := objectFields(r.Query)
+		if err != nil {
+			return nil, fmt.Errorf("search query: %s", err)
+		}
+		for key, value := range query {
+			body[key] = value
+		}
+	}
+
+	for key, value := range fields {
+		body[key] = value
+	}
+
+	return body, nil
+}
+
+// fields returns the top-level keys of the request body that are set by
+// explicit fields on the SearchRequest.
+func (r SearchRequest) fields() map[string]interface{} {
+	fields := map[string]interface{}{}
+	if len(r.Aggregations) > 0 {
+		fields["aggs"] = r.Aggregations
+	}
+	if len(r.Suggest) > 0 {
+		fields["suggest"] = r.Suggest
+	}
+	switch {
+	case r.SourceFilter != nil:
+		fields["_source"] = r.SourceFilter
+	case len(r.SourceFields) > 0:
+		fields["_source"] = r.SourceFields
+	}
+	if r.Highlight != nil {
+		fields["highlight"] = r.Highlight
+	}
+	if len(r.StoredFields) > 0 {
+		fields["fields"] = r.StoredFields
+	}
+	if len(r.ScriptFields) > 0 {
+		fields["script_fields"] = r.ScriptFields
+	}
+	if r.MinScore != nil {
+		fields["min_score"] = *r.MinScore
+	}
+	if r.PostFilter != nil {
+		fields["post_filter"] = r.PostFilter
+	}
+	if len(r.IndicesBoost) > 0 {
+		fields["indices_boost"] = r.IndicesBoost
+	}
+	if r.Rescore != nil {
+		fields["rescore"] = r.Rescore
+	}
+	if len(r.Sort) > 0 {
+		fields["sort"] = r.Sort
+	}
+	if len(r.SearchAfter) > 0 {
+		fields["search_after"] = r.SearchAfter
+	}
+	if r.TrackScores {
+		fields["track_scores"] = true
+	}
+	if r.TrackTotalHits != nil {
+		fields["track_total_hits"] = *r.TrackTotalHits
+	}
+	if r.Timeout != "" {
+		fields["timeout"] = r.Timeout
+	}
+	if r.TerminateAfter > 0 {
+		fields["terminate_after"] = r.TerminateAfter
+	}
+	if r.Explain {
+		fields["explain"] = true
+	}
+	if r.Version {
+		fields["version"] = true
+	}
+	return fields
+}
+
+// http://www.elasticsearch.org/guide/reference/api/search/highlighting/
+// Zero values are replaced with defaults when marshaled: <em> tags, fragments
+// of 100 characters, and at most 5 fragments per field.
+type HighlightConfig struct {
+	Fields            []string
+	PreTags           []string
+	PostTags          []string
+	FragmentSize      int
+	NumberOfFragments int
+	RequireFieldMatch bool
+}
+
+func (c HighlightConfig) MarshalJSON() ([]byte, error) {
+	highlight := struct {
+		Fields            map[string]interface{} `json:"fields"`
+		PreTags           []string               `json:"pre_tags"`
+		PostTags          []string               `json:"post_tags"`
+		FragmentSize      int                    `json:"fragment_size"`
+		NumberOfFragments int                    `json:"number_of_fragments"`
+		RequireFieldMatch bool                   `json:"require_field_match,omitempty"`
+	}{
+		Fields:            map[string]interface{}{},
+		PreTags:           c.PreTags,
+		PostTags:          c.PostTags,
+		FragmentSize:      c.FragmentSize,
+		NumberOfFragments: c.NumberOfFragments,
+		RequireFieldMatch: c.RequireFieldMatch,
+	}
+
+	for _, field := range c.Fields {
+		highlight.Fields[field] = map[string]interface{}{} // render to '{}'
+	}
+	if len(highlight.PreTags) <= 0 {
+		highlight.PreTags = []string{"<em>"}
+	}
+	if len(highlight.PostTags) <= 0 {
+		highlight.PostTags = []string{"</em>"}
+	}
+	if highlight.FragmentSize <= 0 {
+		highlight.FragmentSize = 100
+	}
+	if highlight.NumberOfFragments <= 0 {
+		highlight.NumberOfFragments = 5
+	}
+
+	return json.Marshal(highlight)
+}
+
+// http://www.elasticsearch.org/guide/reference/api/search/script-fields/
+type ScriptField struct {
+	Script string                 `json:"script"`
+	Lang   string                 `json:"lang,omitempty"`
+	Params map[string]interface{} `json:"params,omitempty"`
+}
+
+// http://www.elasticsearch.org/guide/reference/api/search/source-filtering/
+type SourceFilter struct {
+	Includes []string `json:"includes,omitempty"`
+	Excludes []string `json:"excludes,omitempty"`
+}
+
+// http://www.elasticsearch.org/guide/reference/api/search/rescore/
+// The top WindowSize hits of each shard are rescored with the Query. Their
+// final score combines the original and rescore query scores, multiplied by
+// QueryWeight and RescoreQueryWeight respectively. Zero weights are left to
+// ElasticSearch's defaults.
+type Rescore struct {
+	WindowSize         int
+	Query              SubQuery
+	QueryWeight        float32
+	RescoreQueryWeight float32
+}
+
+func (r Rescore) MarshalJSON() ([]byte, error) {
+	type query struct {
+		RescoreQuery       SubQuery `json:"rescore_query"`
+		QueryWeight        float32  `json:"query_weight,omitempty"`
+		RescoreQueryWeight float32  `json:"rescore_query_weight,omitempty"`
+	}
+	return json.Marshal(struct {
+		WindowSize int   `json:"window_size,omitempty"`
+		Query      query `json:"query"`
+	}{
+		WindowSize: r.WindowSize,
+		Query:      query{r.Query, r.QueryWeight, r.RescoreQueryWeight},
+	})
+}
+
+// http://www.elasticsearch.org/guide/reference/api/search/sort/
+// A SortClause is one element of a search's sort: a plain field name (string),
+// a FieldSort, a ScriptSort, or a GeoDistanceSort.
+type SortClause interface{}
+
+// FieldSort sorts by the value of a field. Order is "asc" or "desc"; if it's
+// empty, ElasticSearch's default for the field applies.
+type FieldSort struct {
+	Field string
+	Order string
+}
+
+func (s FieldSort) MarshalJSON() ([]byte, error) {
+	return json.Marshal(map[string]interface{}{
+		s.Field: struct {
+			Order string `json:"order,omitempty"`
+		}{s.Order},
+	})
+}
+
+// ScriptSort sorts by the result of a script. Type is the type of that result,
+// eg. "number" or "string".
+type ScriptSort struct {
+	Script string
+	Type   string
+	Order  string
+}
+
+func (s ScriptSort) MarshalJSON() ([]byte, error) {
+	return json.Marshal(map[string]interface{}{
+		"_script": struct {
+			Script string `json:"script"`
+			Type   string `json:"type"`
+			Order  string `json:"order,omitempty"`
+		}{s.Script, s.Type, s.Order},
+	})
 }
 
+// GeoDistanceSort sorts by the distance between a geo_point Field and the
+// point at Lat, Lon. Unit (eg. "km") is the unit of the returned sort values.
+type GeoDistanceSort struct {
+	Field    string
+	Lat, Lon float64
+	Order    string
+	Unit     string
+}
+
+func (s GeoDistanceSort) MarshalJSON() ([]byte, error) {
+	sort := map[string]interface{}{
+		s.Field: map[string]float64{"lat": s.Lat, "lon": s.Lon},
+	}
+	if s.Order != "" {
+		sort["order"] = s.Order
+	}
+	if s.Unit != "" {
+		sort["unit"] = s.Unit
+	}
+	return json.Marshal(map[string]interface{}{"_geo_distance": sort})
+}
+
+// Request builds a POST rather than a GET, as a GET with a body is rejected by
+// many proxies, and ElasticSearch accepts either.
 func (r SearchRequest) Request(uri *url.URL) (*http.Request, error) {
+	if err := r.Params.Validate(); err != nil {
+		return nil, err
+	}
+
 	uri.Path = r.Path()
 	uri.RawQuery = r.Params.Values().Encode()
 
+	body, err := r.body()
+	if err != nil {
+		return nil, err
+	}
+
+	if body == nil {
+		return http.NewRequest("POST", uri.String(), nil) // implicit match_all
+	}
+
 	buf := new(bytes.Buffer)
-	enc := json.NewEncoder(buf)
+	if err := json.NewEncoder(buf).Encode(body); err != nil {
+		return nil, err
+	}
+
+	return newRequest("POST", uri.String(), contentTypeJSON, buf)
+}
 
-	if err := r.EncodeQuery(enc); err != nil {
+// countRequest is a SearchRequest for the total number of hits only: it asks
+// for no hits to be returned, overriding any size in the request.
+type countRequest struct {
+	SearchRequest
+}
+
+func (r countRequest) Request(uri *url.URL) (*http.Request, error) {
+	body, err := r.body()
+	if err != nil {
 		return nil, err
 	}
 
-	return http.NewRequest("GET", uri.String(), buf)
+	fields, err := objectFields(body)
+	if err != nil {
+		return nil, fmt.Errorf("search query: %s", err)
+	}
+	if fields == nil {
+		fields = map[string]json.RawMessage{} // implicit match_all
+	}
+	fields["size"] = json.RawMessage(`0`)
+
+	return SearchRequest{Params: r.Params, Query: fields}.Request(uri)
+}
+
+// withServerVersion asks ElasticSearch 7 and later to count every hit, rather
+// than stopping at its default of 10000.
+func (r countRequest) withServerVersion(version string) Fireable {
+	if majorVersion(version) >= 7 && r.TrackTotalHits == nil {
+		track := true
+		r.TrackTotalHits = &track
+	}
+	return r
 }
 
+// Path returns the path of the search, scoped to the indices and types in the
+// Params. It doesn't check the names; Request does, via Params.Validate.
 func (r SearchRequest) Path() string {
+	return r.Params.path("_search")
+}
+
+// path returns the path to the given endpoint (eg. "_search"), scoped to the
+// indices and types in the params.
+func (p SearchParams) path(endpoint string) string {
 	switch true {
-	case len(r.Params.Indices) == 0 && len(r.Params.Types) == 0:
+	case len(p.Indices) == 0 && len(p.Types) == 0:
 		return fmt.Sprintf(
-			"/_search", // all indices, all types
+			"/%s", // all indices, all types
+			endpoint,
 		)
 
-	case len(r.Params.Indices) > 0 && len(r.Params.Types) == 0:
+	case len(p.Indices) > 0 && len(p.Types) == 0:
 		return fmt.Sprintf(
-			"/%s/_search",
-			strings.Join(r.Params.Indices, ","),
+			"/%s/%s",
+			strings.Join(p.Indices, ","),
+			endpoint,
 		)
 
-	case len(r.Params.Indices) == 0 && len(r.Params.Types) > 0:
+	case len(p.Indices) == 0 && len(p.Types) > 0:
 		return fmt.Sprintf(
-			"/_all/%s/_search",
-			strings.Join(r.Params.Types, ","),
+			"/_all/%s/%s",
+			strings.Join(p.Types, ","),
+			endpoint,
 		)
 
-	case len(r.Params.Indices) > 0 && len(r.Params.Types) > 0:
+	case len(p.Indices) > 0 && len(p.Types) > 0:
 		return fmt.Sprintf(
-			"/%s/%s/_search",
-			strings.Join(r.Params.Indices, ","),
-			strings.Join(r.Params.Types, ","),
+			"/%s/%s/%s",
+			strings.Join(p.Indices, ","),
+			strings.Join(p.Types, ","),
+			endpoint,
 		)
 	}
 	panic("unreachable")
@@ -116,6 +602,11 @@ type MultiSearchParams struct {
 	SearchType string
 }
 
+// Validate returns an error if the params would produce an invalid request.
+func (p MultiSearchParams) Validate() error {
+	return validateSearchType(p.SearchType)
+}
+
 func (p MultiSearchParams) Values() url.Values {
 	return values(map[string]string{
 		"search_type": p.SearchType,
@@ -128,6 +619,15 @@ type MultiSearchRequest struct {
 }
 
 func (r MultiSearchRequest) Request(uri *url.URL) (*http.Request, error) {
+	if err := r.Params.Validate(); err != nil {
+		return nil, err
+	}
+	for _, req := range r.Requests {
+		if err := req.Params.Validate(); err != nil {
+			return nil, err
+		}
+	}
+
 	uri.Path = "/_msearch"
 	uri.RawQuery = r.Params.Values().Encode()
 
@@ -143,5 +643,240 @@ func (r MultiSearchRequest) Request(uri *url.URL) (*http.Request, error) {
 		}
 	}
 
-	return http.NewRequest("GET", uri.String(), buf)
+	return newRequest("POST", uri.String(), contentTypeNDJSON, buf)
+}
+
+// MultiSearchBuilder accumulates SearchRequests into a MultiSearchRequest.
+// The zero value is ready to use. If Deduplicate is set, a SearchRequest
+// identical to one already added isn't added again.
+type MultiSearchBuilder struct {
+	Params      MultiSearchParams
+	Deduplicate bool
+
+	requests []SearchRequest
+	index    map[string]int // encoded request to position in requests
+}
+
+// Add appends the SearchRequest, and returns its position in the built
+// MultiSearchRequest, which is also the position of its response. With
+// Deduplicate, that's the position of the identical request, if any.
+func (b *MultiSearchBuilder) Add(r SearchRequest) int {
+	if b.Deduplicate {
+		buf := new(bytes.Buffer)
+		enc := json.NewEncoder(buf)
+		if r.EncodeMultiHeader(enc) == nil && r.EncodeQuery(enc) == nil {
+			if i, ok := b.index[buf.String()]; ok {
+				return i
+			}
+			if b.index == nil {
+				b.index = map[string]int{}
+			}
+			b.index[buf.String()] = len(b.requests)
+		}
+	}
+
+	b.requests = append(b.requests, r)
+	return len(b.requests) - 1
+}
+
+// Build returns a MultiSearchRequest of the SearchRequests added so far, in
+// the order they were added.
+func (b *MultiSearchBuilder) Build() MultiSearchRequest {
+	return MultiSearchRequest{
+		Params:   b.Params,
+		Requests: append([]SearchRequest{}, b.requests...),
+	}
+}
+
+//
+//
+//
+
+// DeleteByQueryRequest deletes every document matching the Query, within the
+// indices and types given by the Params. Unlike SearchRequest, the Query is
+// just the query itself: it's wrapped with QueryWrapper when marshaled. Both
+// the indices and the Query are required, so that nothing is deleted from
+// every index, or every document, by accident. To really delete everything,
+// pass MatchAllQuery.
+type DeleteByQueryRequest struct {
+	Params SearchParams
+	Query  SubQuery
+}
+
+func (r DeleteByQueryRequest) Request(uri *url.URL) (*http.Request, error) {
+	if len(r.Params.Indices) <= 0 {
+		return nil, fmt.Errorf("delete by query: no indices specified")
+	}
+	if r.Query == nil {
+		return nil, fmt.Errorf("delete by query: no query specified")
+	}
+	if err := r.Params.Validate(); err != nil {
+		return nil, err
+	}
+
+	uri.Path = r.Params.path("_delete_by_query")
+	uri.RawQuery = r.Params.Values().Encode()
+
+	buf := new(bytes.Buffer)
+	if err := json.NewEncoder(buf).Encode(QueryWrapper(r.Query)); err != nil {
+		return nil, err
+	}
+
+	return newRequest("POST", uri.String(), contentTypeJSON, buf)
+}
+
+//
+//
+//
+
+// ExplainRequest explains how the document with the given Id scores against
+// the Query, or why it doesn't match. As with DeleteByQueryRequest, the Query
+// is wrapped with QueryWrapper when marshaled.
+type ExplainRequest struct {
+	Index string
+	Type  string
+	Id    string
+	Query SubQuery
+}
+
+func (r ExplainRequest) Request(uri *url.URL) (*http.Request, error) {
+	p := IndexParams{Index: r.Index, Type: r.Type, Id: r.Id}
+	if err := p.validate(true); err != nil {
+		return nil, err
+	}
+
+	p.setPath(uri, "_explain")
+
+	buf := new(bytes.Buffer)
+	if err := json.NewEncoder(buf).Encode(QueryWrapper(r.Query)); err != nil {
+		return nil, err
+	}
+
+	return newRequest("POST", uri.String(), contentTypeJSON, buf)
+}
+
+// ValidateQueryRequest checks whether the Query is valid against the Indices,
+// without running it. As with SearchRequest, it's a POST rather than a GET.
+// The Query is wrapped with QueryWrapper when marshaled.
+type ValidateQueryRequest struct {
+	Indices []string
+	Query   SubQuery
+	Explain bool
+}
+
+func (r ValidateQueryRequest) Request(uri *url.URL) (*http.Request, error) {
+	p := SearchParams{Indices: r.Indices}
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+
+	uri.Path = p.path("_validate/query")
+	if r.Explain {
+		uri.RawQuery = url.Values{"explain": []string{"true"}}.Encode()
+	}
+
+	buf := new(bytes.Buffer)
+	if err := json.NewEncoder(buf).Encode(QueryWrapper(r.Query)); err != nil {
+		return nil, err
+	}
+
+	return newRequest("POST", uri.String(), contentTypeJSON, buf)
+}
+
+//
+//
+//
+
+// UpdateByQueryRequest runs the Script against every document in the Indices
+// which matches the Query. A nil Query matches all documents.
+type UpdateByQueryRequest struct {
+	Indices []string
+	Query   SubQuery
+	Script  string
+	Params  map[string]interface{}
+}
+
+func (r UpdateByQueryRequest) Request(uri *url.URL) (*http.Request, error) {
+	if len(r.Indices) <= 0 {
+		return nil, fmt.Errorf("update by query: no indices specified")
+	}
+
+	uri.Path = SearchParams{Indices: r.Indices}.path("_update_by_query")
+
+	type script struct {
+		Source string                 `json:"source"`
+		Params map[string]interface{} `json:"params,omitempty"`
+	}
+
+	body := struct {
+		Query  SubQuery `json:"query,omitempty"`
+		Script *script  `json:"script,omitempty"`
+	}{
+		Query: r.Query,
+	}
+	if r.Script != "" {
+		body.Script = &script{Source: r.Script, Params: r.Params}
+	}
+
+	buf := new(bytes.Buffer)
+	if err := json.NewEncoder(buf).Encode(body); err != nil {
+		return nil, err
+	}
+
+	return newRequest("POST", uri.String(), contentTypeJSON, buf)
+}
+
+//
+//
+//
+
+// ReindexRequest copies the documents in SourceIndex which match the Query
+// into DestIndex, optionally transforming each with the Script. A nil Query
+// copies all documents.
+type ReindexRequest struct {
+	SourceIndex string
+	DestIndex   string
+	Query       SubQuery
+	Script      string
+}
+
+func (r ReindexRequest) Request(uri *url.URL) (*http.Request, error) {
+	switch {
+	case r.SourceIndex == "":
+		return nil, fmt.Errorf("reindex: no source index specified")
+	case r.DestIndex == "":
+		return nil, fmt.Errorf("reindex: no dest index specified")
+	}
+
+	uri.Path = "/_reindex"
+
+	type source struct {
+		Index string   `json:"index"`
+		Query SubQuery `json:"query,omitempty"`
+	}
+	type dest struct {
+		Index string `json:"index"`
+	}
+	type script struct {
+		Source string `json:"source"`
+	}
+
+	body := struct {
+		Source source  `json:"source"`
+		Dest   dest    `json:"dest"`
+		Script *script `json:"script,omitempty"`
+	}{
+		Source: source{Index: r.SourceIndex, Query: r.Query},
+		Dest:   dest{Index: r.DestIndex},
+	}
+	if r.Script != "" {
+		body.Script = &script{Source: r.Script}
+	}
+
+	buf := new(bytes.Buffer)
+	if err := json.NewEncoder(buf).Encode(body); err != nil {
+		return nil, err
+	}
+
+	return newRequest("POST", uri.String(), contentTypeJSON, buf)
 }
@@ -1,9 +1,12 @@
 package elasticsearch_test
 
 import (
+	"bytes"
+	"encoding/json"
 	es "github.com/peterbourgon/elasticsearch"
 	"io/ioutil"
 	"net/url"
+	"reflect"
 	"strings"
 	"testing"
 )
@@ -15,71 +18,64 @@ func TestSearchRequestPath(t *testing.T) {
 	}{
 		{
 			r: es.SearchRequest{
-				es.SearchParams{
+				Params: es.SearchParams{
 					Indices: []string{},
 					Types:   []string{},
 				},
-				nil,
 			},
 			expected: "/_search",
 		},
 		{
 			r: es.SearchRequest{
-				es.SearchParams{
+				Params: es.SearchParams{
 					Indices: []string{"i1"},
 					Types:   []string{},
 				},
-				nil,
 			},
 			expected: "/i1/_search",
 		},
 		{
 			r: es.SearchRequest{
-				es.SearchParams{
+				Params: es.SearchParams{
 					Indices: []string{},
 					Types:   []string{"t1"},
 				},
-				nil,
 			},
 			expected: "/_all/t1/_search",
 		},
 		{
 			r: es.SearchRequest{
-				es.SearchParams{
+				Params: es.SearchParams{
 					Indices: []string{"i1"},
 					Types:   []string{"t1"},
 				},
-				nil,
 			},
 			expected: "/i1/t1/_search",
 		},
 		{
 			r: es.SearchRequest{
-				es.SearchParams{
+				Params: es.SearchParams{
 					Indices: []string{"i1", "i2"},
 					Types:   []string{},
 				},
-				nil,
 			},
 			expected: "/i1,i2/_search",
 		},
 		{
 			r: es.SearchRequest{
-				es.SearchParams{
+				Params: es.SearchParams{
 					Indices: []string{},
 					Types:   []string{"t1", "t2", "t3"},
 				},
-				nil,
 			},
 			expected: "/_all/t1,t2,t3/_search",
 		},
 		{
 			r: es.SearchRequest{
-				es.SearchParams{
+				Params: es.SearchParams{
 					Indices: []string{"i1", "i2"},
 					Types:   []string{"t1", "t2", "t3"},
 				},
-				nil,
 			},
 			expected: "/i1,i2/t1,t2,t3/_search",
 		},
@@ -90,6 +86,28 @@ func TestSearchRequestPath(t *testing.T) {
 	}
 }
 
+func TestSearchRequestPathValidation(t *testing.T) {
+	for _, tuple := range []struct {
+		p     es.SearchParams
+		valid bool
+	}{
+		{es.SearchParams{Indices: []string{"i1", "i2"}, Types: []string{"t1"}}, true},
+		{es.SearchParams{Indices: []string{"i1,i2"}}, false},
+		{es.SearchParams{Indices: []string{"i1/t1"}}, false},
+		{es.SearchParams{Indices: []string{""}}, false},
+		{es.SearchParams{Types: []string{"t1,t2"}}, false},
+		{es.SearchParams{Types: []string{"t1/_search"}}, false},
+	} {
+		_, err := es.SearchRequest{Params: tuple.p}.Request(&url.URL{})
+		if tuple.valid && err != nil {
+			t.Errorf("%+v: %s", tuple.p, err)
+		}
+		if !tuple.valid && err == nil {
+			t.Errorf("%+v: expected error, got none", tuple.p)
+		}
+	}
+}
+
 func TestSearchRequestValues(t *testing.T) {
 	for _, tuple := range []struct {
 		r        es.SearchRequest
@@ -103,6 +121,23 @@ func TestSearchRequestValues(t *testing.T) {
 			},
 			expected: "preference=foo",
 		},
+		{
+			r: es.SearchRequest{
+				Params: es.SearchParams{
+					SearchType: es.SearchTypeDfsQueryThenFetch,
+				},
+			},
+			expected: "search_type=dfs_query_then_fetch",
+		},
+		{
+			r: es.SearchRequest{
+				Params: es.SearchParams{
+					Routing: "kimchy",
+					Parent:  "1",
+				},
+			},
+			expected: "parent=1&routing=kimchy",
+		},
 	} {
 		if expected, got := tuple.expected, tuple.r.Params.Values().Encode(); expected != got {
 			t.Errorf("%v: expected '%s', got '%s'", tuple.r, expected, got)
@@ -110,54 +145,91 @@ func TestSearchRequestValues(t *testing.T) {
 	}
 }
 
+func TestSearchRequestPreference(t *testing.T) {
+	for _, tuple := range []struct {
+		preference string
+		expected   string
+	}{
+		{"", ""},
+		{es.PreferencePrimary, "_primary"},
+		{es.PreferenceLocal, "_local"},
+		{es.PreferenceOnlyNodes + "node1,node2", "_only_nodes:node1,node2"},
+		{es.PreferCustom("session-1234"), "session-1234"},
+		{es.PreferCustom("_session"), "session"},
+	} {
+		request, err := es.SearchRequest{
+			Params: es.SearchParams{Preference: tuple.preference},
+		}.Request(&url.URL{})
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if expected, got := tuple.expected, request.URL.Query().Get("preference"); expected != got {
+			t.Errorf("expected preference = %q; got %q", expected, got)
+		}
+	}
+}
+
 func TestMultiSearchRequestBody(t *testing.T) {
 	m := es.MultiSearchRequest{
 		es.MultiSearchParams{},
 		[]es.SearchRequest{
 			es.SearchRequest{
-				es.SearchParams{
+				Params: es.SearchParams{
 					Indices: []string{},
 					Types:   []string{},
 				},
-				map[string]interface{}{"query": "1"},
+				Query: map[string]interface{}{"query": "1"},
 			},
 			es.SearchRequest{
-				es.SearchParams{
+				Params: es.SearchParams{
 					Indices: []string{"i1"},
 					Types:   []string{},
 				},
-				map[string]interface{}{"query": "2"},
+				Query: map[string]interface{}{"query": "2"},
 			},
 			es.SearchRequest{
-				es.SearchParams{
+				Params: es.SearchParams{
 					Indices: []string{},
 					Types:   []string{"t1"},
 				},
-				map[string]interface{}{"query": "3"},
+				Query: map[string]interface{}{"query": "3"},
 			},
 			es.SearchRequest{
-				es.SearchParams{
+				Params: es.SearchParams{
 					Indices: []string{"i1"},
 					Types:   []string{"t1"},
 				},
-				map[string]interface{}{"query": "4"},
+				Query: map[string]interface{}{"query": "4"},
 			},
 			es.SearchRequest{
-				es.SearchParams{
+				Params: es.SearchParams{
 					Indices: []string{"i1", "i2"},
 					Types:   []string{"t1", "t2", "t3"},
 				},
-				map[string]interface{}{"query": "5"},
+				Query: map[string]interface{}{"query": "5"},
 			},
 		},
 	}
 
 	req, err := m.Request(&url.URL{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expected, got := "POST", req.Method; expected != got {
+		t.Errorf("Method: expected '%s', got '%s'", expected, got)
+	}
 
 	if expected, got := "/_msearch", req.URL.Path; expected != got {
 		t.Errorf("Path: expected '%s', got '%s'", expected, got)
 	}
 
+	if expected, got := "application/x-ndjson", req.Header.Get("Content-Type"); expected != got {
+		t.Errorf("Content-Type: expected '%s', got '%s'", expected, got)
+	}
+
 	expected := strings.Join(
 		[]string{
 			`{}`,
@@ -181,3 +253,1043 @@ func TestMultiSearchRequestBody(t *testing.T) {
 		t.Errorf("Body: expected:\n---\n%s\n---\ngot:\n---\n%s\n---\n", expected, got)
 	}
 }
+
+func TestMultiSearchBuilder(t *testing.T) {
+	a := es.SearchRequest{Params: es.SearchParams{Indices: []string{"a"}}, Query: es.QueryWrapper(es.MatchAllQuery())}
+	b := es.SearchRequest{Params: es.SearchParams{Indices: []string{"b"}}, Query: es.QueryWrapper(es.MatchAllQuery())}
+	c := es.SearchRequest{Params: es.SearchParams{Indices: []string{"c"}}, Query: es.QueryWrapper(es.MatchAllQuery())}
+
+	for _, tuple := range []struct {
+		deduplicate bool
+		positions   []int
+		indices     []string
+	}{
+		{false, []int{0, 1, 2, 3}, []string{"a", "b", "c", "a"}},
+		{true, []int{0, 1, 2, 0}, []string{"a", "b", "c"}},
+	} {
+		builder := es.MultiSearchBuilder{Deduplicate: tuple.deduplicate}
+
+		positions := []int{}
+		for _, r := range []es.SearchRequest{a, b, c, a} {
+			positions = append(positions, builder.Add(r))
+		}
+
+		if expected, got := tuple.positions, positions; !reflect.DeepEqual(expected, got) {
+			t.Errorf("deduplicate %v: expected positions %v; got %v", tuple.deduplicate, expected, got)
+		}
+
+		indices := []string{}
+		for _, r := range builder.Build().Requests {
+			indices = append(indices, r.Params.Indices[0])
+		}
+
+		if expected, got := tuple.indices, indices; !reflect.DeepEqual(expected, got) {
+			t.Errorf("deduplicate %v: expected requests %v; got %v", tuple.deduplicate, expected, got)
+		}
+	}
+}
+
+func TestSearchRequestExtra(t *testing.T) {
+	request, err := es.SearchRequest{
+		Params: es.SearchParams{
+			Indices: []string{"twitter"},
+		},
+		Query: es.QueryWrapper(es.MatchAllQuery()),
+		Extra: map[string]interface{}{
+			"aggs": map[string]interface{}{
+				"users": map[string]interface{}{
+					"terms": map[string]string{"field": "user"},
+				},
+			},
+			"_source": false,
+			"query":   "should be overridden",
+		},
+	}.Request(&url.URL{})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var body map[string]json.RawMessage
+	if err := json.NewDecoder(request.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+
+	if expected, got := `{"match_all":{}}`, string(body["query"]); expected != got {
+		t.Errorf("expected query = %s; got %s", expected, got)
+	}
+
+	if expected, got := `{"users":{"terms":{"field":"user"}}}`, string(body["aggs"]); expected != got {
+		t.Errorf("expected aggs = %s; got %s", expected, got)
+	}
+
+	if expected, got := `false`, string(body["_source"]); expected != got {
+		t.Errorf("expected _source = %s; got %s", expected, got)
+	}
+}
+
+func TestSearchRequestAggregations(t *testing.T) {
+	request, err := es.SearchRequest{
+		Query: es.QueryWrapper(es.MatchAllQuery()),
+		Aggregations: es.Aggregations{
+			{
+				Name: "tweets",
+				Agg:  es.FilterAgg(es.TermFilter(es.TermFilterParams{Field: "type", Value: "tweet"})),
+				Aggs: es.Aggregations{
+					{Name: "users", Agg: es.TermsAgg(es.TermsAggParams{Field: "user"})},
+				},
+			},
+		},
+	}.Request(&url.URL{})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var body map[string]json.RawMessage
+	if err := json.NewDecoder(request.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+
+	if expected, got := `{"match_all":{}}`, string(body["query"]); expected != got {
+		t.Errorf("expected query = %s; got %s", expected, got)
+	}
+
+	if expected, got := `{"tweets":{"aggs":{"users":{"terms":{"field":"user"}}},"filter":{"term":{"type":"tweet"}}}}`, string(body["aggs"]); expected != got {
+		t.Errorf("expected aggs = %s; got %s", expected, got)
+	}
+}
+
+func TestAggregationsWithoutType(t *testing.T) {
+	aggs := es.Aggregations{
+		{
+			Name: "tweets",
+			Aggs: es.Aggregations{
+				{Name: "users", Agg: es.TermsAgg(es.TermsAggParams{Field: "user"})},
+			},
+		},
+	}
+
+	_, err := json.Marshal(aggs)
+	if err == nil {
+		t.Fatalf("expected error marshaling an aggregation without a type, got none")
+	}
+	if expected, got := `aggregation "tweets": no aggregation type`, err.Error(); !strings.Contains(got, expected) {
+		t.Errorf("expected error to contain %q; got %q", expected, got)
+	}
+}
+
+func TestSearchRequestRangeAgg(t *testing.T) {
+	fifty := 50.0
+	request, err := es.SearchRequest{
+		Aggregations: es.Aggregations{
+			{
+				Name: "price_ranges",
+				Agg: es.RangeAgg(es.RangeAggParams{
+					Field:  "price",
+					Ranges: []es.AggRange{{Key: "cheap", To: &fifty}, {Key: "dear", From: &fifty}},
+				}),
+			},
+		},
+	}.Request(&url.URL{})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var body map[string]json.RawMessage
+	if err := json.NewDecoder(request.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+
+	if expected, got := `{"price_ranges":{"range":{"field":"price","ranges":[{"key":"cheap","to":50},{"key":"dear","from":50}]}}}`, string(body["aggs"]); expected != got {
+		t.Errorf("expected aggs = %s; got %s", expected, got)
+	}
+}
+
+func TestSearchRequestSource(t *testing.T) {
+	for _, tuple := range []struct {
+		r        es.SearchRequest
+		expected string
+	}{
+		{
+			r: es.SearchRequest{
+				SourceFilter: &es.SourceFilter{
+					Includes: []string{"user", "message"},
+					Excludes: []string{"message.raw"},
+				},
+			},
+			expected: `{"includes":["user","message"],"excludes":["message.raw"]}`,
+		},
+		{
+			r: es.SearchRequest{
+				SourceFields: []string{"user", "message"},
+			},
+			expected: `["user","message"]`,
+		},
+		{
+			r: es.SearchRequest{
+				SourceFilter: &es.SourceFilter{Excludes: []string{"message"}},
+				SourceFields: []string{"user"},
+			},
+			expected: `{"excludes":["message"]}`,
+		},
+	} {
+		request, err := tuple.r.Request(&url.URL{})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var body map[string]json.RawMessage
+		if err := json.NewDecoder(request.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+
+		if expected, got := tuple.expected, string(body["_source"]); expected != got {
+			t.Errorf("expected _source = %s; got %s", expected, got)
+		}
+	}
+}
+
+func TestSearchRequestStoredFields(t *testing.T) {
+	request, err := es.SearchRequest{
+		Query:        es.QueryWrapper(es.MatchAllQuery()),
+		StoredFields: []string{"user", "post_date"},
+	}.Request(&url.URL{})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var body map[string]json.RawMessage
+	if err := json.NewDecoder(request.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+
+	if expected, got := `["user","post_date"]`, string(body["fields"]); expected != got {
+		t.Errorf("expected fields = %s; got %s", expected, got)
+	}
+}
+
+func TestSearchRequestScriptFields(t *testing.T) {
+	request, err := es.SearchRequest{
+		Query: es.QueryWrapper(es.MatchAllQuery()),
+		ScriptFields: map[string]es.ScriptField{
+			"doubled": {
+				Script: "doc['likes'].value * factor",
+				Lang:   "groovy",
+				Params: map[string]interface{}{"factor": 2},
+			},
+		},
+	}.Request(&url.URL{})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var body map[string]json.RawMessage
+	if err := json.NewDecoder(request.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+
+	if expected, got := `{"doubled":{"script":"doc['likes'].value * factor","lang":"groovy","params":{"factor":2}}}`, string(body["script_fields"]); expected != got {
+		t.Errorf("expected script_fields = %s; got %s", expected, got)
+	}
+}
+
+func TestSearchRequestMinScore(t *testing.T) {
+	zero, half := 0.0, 0.5
+	for _, tuple := range []struct {
+		minScore *float64
+		expected string
+	}{
+		{nil, ``},
+		{&zero, `0`},
+		{&half, `0.5`},
+	} {
+		request, err := es.SearchRequest{
+			Query:    es.QueryWrapper(es.MatchAllQuery()),
+			MinScore: tuple.minScore,
+		}.Request(&url.URL{})
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var body map[string]json.RawMessage
+		if err := json.NewDecoder(request.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+
+		if expected, got := tuple.expected, string(body["min_score"]); expected != got {
+			t.Errorf("expected min_score = %q; got %q", expected, got)
+		}
+	}
+}
+
+func TestSearchRequestPostFilter(t *testing.T) {
+	request, err := es.SearchRequest{
+		Query: es.QueryWrapper(es.MatchAllQuery()),
+		PostFilter: es.TermFilter(es.TermFilterParams{
+			Field: "user",
+			Value: "kimchy",
+		}),
+		Extra: map[string]interface{}{
+			"size": 20,
+		},
+	}.Request(&url.URL{})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var body map[string]json.RawMessage
+	if err := json.NewDecoder(request.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+
+	if expected, got := `{"match_all":{}}`, string(body["query"]); expected != got {
+		t.Errorf("expected query = %s; got %s", expected, got)
+	}
+
+	if expected, got := `{"term":{"user":"kimchy"}}`, string(body["post_filter"]); expected != got {
+		t.Errorf("expected post_filter = %s; got %s", expected, got)
+	}
+
+	if expected, got := `20`, string(body["size"]); expected != got {
+		t.Errorf("expected size = %s; got %s", expected, got)
+	}
+}
+
+func TestSearchRequestMultiHeader(t *testing.T) {
+	for _, tuple := range []struct {
+		r        es.SearchRequest
+		expected string
+	}{
+		{
+			r: es.SearchRequest{
+				Params: es.SearchParams{
+					Indices: []string{},
+					Types:   []string{},
+				},
+			},
+			expected: `{}`,
+		},
+		{
+			r: es.SearchRequest{
+				Params: es.SearchParams{
+					Indices: []string{"index1", "index2"},
+				},
+			},
+			expected: `{"index":["index1","index2"]}`,
+		},
+		{
+			r: es.SearchRequest{
+				Params: es.SearchParams{
+					Indices: []string{"index1", "index2"},
+					Types:   []string{},
+					Routing: "kimchy",
+				},
+			},
+			expected: `{"index":["index1","index2"],"routing":"kimchy"}`,
+		},
+	} {
+		var buf bytes.Buffer
+		if err := tuple.r.EncodeMultiHeader(json.NewEncoder(&buf)); err != nil {
+			t.Fatal(err)
+		}
+
+		if expected, got := tuple.expected+"\n", buf.String(); expected != got {
+			t.Errorf("expected header %q; got %q", expected, got)
+		}
+	}
+}
+
+func TestSearchRequestMethod(t *testing.T) {
+	request, err := es.SearchRequest{
+		Params: es.SearchParams{
+			Indices: []string{"twitter"},
+		},
+		Query: es.QueryWrapper(es.MatchAllQuery()),
+	}.Request(&url.URL{})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expected, got := "POST", request.Method; expected != got {
+		t.Errorf("expected method = %q; got %q", expected, got)
+	}
+
+	if expected, got := "/twitter/_search", request.URL.Path; expected != got {
+		t.Errorf("expected path = %q; got %q", expected, got)
+	}
+
+	body, err := ioutil.ReadAll(request.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expected, got := `{"query":{"match_all":{}}}`+"\n", string(body); expected != got {
+		t.Errorf("expected body = %q; got %q", expected, got)
+	}
+}
+
+func TestSearchRequestNilQuery(t *testing.T) {
+	request, err := es.SearchRequest{
+		Params: es.SearchParams{
+			Indices: []string{"twitter"},
+		},
+	}.Request(&url.URL{})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if request.Body != nil {
+		body, _ := ioutil.ReadAll(request.Body)
+		t.Errorf("expected request to have an empty body; got %q", body)
+	}
+
+	m, err := es.MultiSearchRequest{
+		Requests: []es.SearchRequest{
+			es.SearchRequest{
+				Params: es.SearchParams{
+					Indices: []string{"twitter"},
+				},
+			},
+		},
+	}.Request(&url.URL{})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body, err := ioutil.ReadAll(m.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expected, got := "{\"index\":[\"twitter\"]}\n{}\n", string(body); expected != got {
+		t.Errorf("expected body = %q; got %q", expected, got)
+	}
+}
+
+func TestSearchRequestSearchType(t *testing.T) {
+	for _, tuple := range []struct {
+		searchType string
+		valid      bool
+	}{
+		{"", true},
+		{es.SearchTypeQueryThenFetch, true},
+		{es.SearchTypeDfsQueryThenFetch, true},
+		{es.SearchTypeCount, true},
+		{es.SearchTypeScan, true},
+		{"dfs_querythenfetch", false},
+	} {
+		request, err := es.SearchRequest{
+			Params: es.SearchParams{
+				SearchType: tuple.searchType,
+			},
+		}.Request(&url.URL{})
+
+		if !tuple.valid {
+			if err == nil {
+				t.Errorf("%q: expected error, got none", tuple.searchType)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("%q: %s", tuple.searchType, err)
+			continue
+		}
+
+		if expected, got := tuple.searchType, request.URL.Query().Get("search_type"); expected != got {
+			t.Errorf("expected search_type = %q; got %q", expected, got)
+		}
+	}
+
+	if _, err := (es.MultiSearchRequest{
+		Requests: []es.SearchRequest{
+			es.SearchRequest{
+				Params: es.SearchParams{SearchType: "bogus"},
+			},
+		},
+	}).Request(&url.URL{}); err == nil {
+		t.Errorf("expected error for invalid sub-request search type, got none")
+	}
+}
+
+func TestSearchRequestTimeout(t *testing.T) {
+	request, err := es.SearchRequest{
+		Query:          es.QueryWrapper(es.MatchAllQuery()),
+		Timeout:        "500ms",
+		TerminateAfter: 1000,
+	}.Request(&url.URL{})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var body map[string]json.RawMessage
+	if err := json.NewDecoder(request.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+
+	if expected, got := `"500ms"`, string(body["timeout"]); expected != got {
+		t.Errorf("expected timeout = %s; got %s", expected, got)
+	}
+
+	if expected, got := `1000`, string(body["terminate_after"]); expected != got {
+		t.Errorf("expected terminate_after = %s; got %s", expected, got)
+	}
+}
+
+func TestSearchRequestExplainVersion(t *testing.T) {
+	for _, tuple := range []struct {
+		r                es.SearchRequest
+		explain, version string
+	}{
+		{
+			r: es.SearchRequest{Query: es.QueryWrapper(es.MatchAllQuery())},
+		},
+		{
+			r:       es.SearchRequest{Query: es.QueryWrapper(es.MatchAllQuery()), Explain: true, Version: true},
+			explain: `true`,
+			version: `true`,
+		},
+	} {
+		request, err := tuple.r.Request(&url.URL{})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var body map[string]json.RawMessage
+		if err := json.NewDecoder(request.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+
+		if expected, got := tuple.explain, string(body["explain"]); expected != got {
+			t.Errorf("expected explain = %q; got %q", expected, got)
+		}
+
+		if expected, got := tuple.version, string(body["version"]); expected != got {
+			t.Errorf("expected version = %q; got %q", expected, got)
+		}
+	}
+}
+
+func TestSearchRequestIndicesBoost(t *testing.T) {
+	request, err := es.SearchRequest{
+		Params:       es.SearchParams{Indices: []string{"index1", "index2"}},
+		Query:        es.QueryWrapper(es.MatchAllQuery()),
+		IndicesBoost: map[string]float32{"index1": 1.4, "index2": 1.3},
+	}.Request(&url.URL{})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var body map[string]json.RawMessage
+	if err := json.NewDecoder(request.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+
+	if expected, got := `{"index1":1.4,"index2":1.3}`, string(body["indices_boost"]); expected != got {
+		t.Errorf("expected indices_boost = %s; got %s", expected, got)
+	}
+}
+
+func TestSearchRequestRescore(t *testing.T) {
+	request, err := es.SearchRequest{
+		Query: es.QueryWrapper(es.MatchAllQuery()),
+		Rescore: &es.Rescore{
+			WindowSize:         50,
+			Query:              es.FieldMatch("message", "the quick brown"),
+			QueryWeight:        0.5,
+			RescoreQueryWeight: 1.5,
+		},
+	}.Request(&url.URL{})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var body map[string]json.RawMessage
+	if err := json.NewDecoder(request.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+
+	if expected, got := `{"window_size":50,"query":{"rescore_query":{"match":{"message":"the quick brown"}},"query_weight":0.5,"rescore_query_weight":1.5}}`, string(body["rescore"]); expected != got {
+		t.Errorf("expected rescore = %s; got %s", expected, got)
+	}
+}
+
+func TestSearchRequestSort(t *testing.T) {
+	for _, tuple := range []struct {
+		sort     []es.SortClause
+		expected string
+	}{
+		{
+			sort:     nil,
+			expected: ``,
+		},
+		{
+			sort:     []es.SortClause{"_score", es.FieldSort{Field: "user", Order: "desc"}},
+			expected: `["_score",{"user":{"order":"desc"}}]`,
+		},
+		{
+			sort: []es.SortClause{es.ScriptSort{
+				Script: "doc['likes'].value * factor",
+				Type:   "number",
+				Order:  "asc",
+			}},
+			expected: `[{"_script":{"script":"doc['likes'].value * factor","type":"number","order":"asc"}}]`,
+		},
+		{
+			sort: []es.SortClause{es.GeoDistanceSort{
+				Field: "pin.location",
+				Lat:   40.5,
+				Lon:   -70,
+				Order: "asc",
+				Unit:  "km",
+			}},
+			expected: `[{"_geo_distance":{"order":"asc","pin.location":{"lat":40.5,"lon":-70},"unit":"km"}}]`,
+		},
+	} {
+		request, err := es.SearchRequest{
+			Query: es.QueryWrapper(es.MatchAllQuery()),
+			Sort:  tuple.sort,
+		}.Request(&url.URL{})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var body map[string]json.RawMessage
+		if err := json.NewDecoder(request.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+
+		if expected, got := tuple.expected, string(body["sort"]); expected != got {
+			t.Errorf("expected sort = %s; got %s", expected, got)
+		}
+	}
+}
+
+func TestSearchRequestTracking(t *testing.T) {
+	yes, no := true, false
+	for _, tuple := range []struct {
+		r                           es.SearchRequest
+		trackScores, trackTotalHits string
+	}{
+		{
+			r: es.SearchRequest{Query: es.QueryWrapper(es.MatchAllQuery())},
+		},
+		{
+			r:              es.SearchRequest{Query: es.QueryWrapper(es.MatchAllQuery()), TrackScores: true, TrackTotalHits: &yes},
+			trackScores:    `true`,
+			trackTotalHits: `true`,
+		},
+		{
+			r:              es.SearchRequest{Query: es.QueryWrapper(es.MatchAllQuery()), TrackTotalHits: &no},
+			trackTotalHits: `false`,
+		},
+	} {
+		request, err := tuple.r.Request(&url.URL{})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var body map[string]json.RawMessage
+		if err := json.NewDecoder(request.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+
+		if expected, got := tuple.trackScores, string(body["track_scores"]); expected != got {
+			t.Errorf("expected track_scores = %q; got %q", expected, got)
+		}
+
+		if expected, got := tuple.trackTotalHits, string(body["track_total_hits"]); expected != got {
+			t.Errorf("expected track_total_hits = %q; got %q", expected, got)
+		}
+	}
+}
+
+func TestSearchRequestSearchAfter(t *testing.T) {
+	var page es.SearchResponse
+	if err := json.Unmarshal([]byte(`{"hits":{"total":2,"hits":[
+		{"_id":"1","sort":[1463538857,"tweet#1"]},
+		{"_id":"2","sort":[1463538858,"tweet#2"]}
+	]}}`), &page); err != nil {
+		t.Fatal(err)
+	}
+	last := page.HitsWrapper.Hits[len(page.HitsWrapper.Hits)-1]
+
+	request, err := es.SearchRequest{
+		Query:       es.QueryWrapper(es.MatchAllQuery()),
+		Sort:        []es.SortClause{es.FieldSort{Field: "date", Order: "asc"}, "_id"},
+		SearchAfter: last.Sort,
+	}.Request(&url.URL{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var body map[string]json.RawMessage
+	if err := json.NewDecoder(request.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+
+	if expected, got := `[1463538858,"tweet#2"]`, string(body["search_after"]); expected != got {
+		t.Errorf("expected search_after = %s; got %s", expected, got)
+	}
+}
+
+func TestContentType(t *testing.T) {
+	p := es.IndexParams{Index: "twitter", Type: "tweet", Id: "1"}
+	doc := map[string]string{"user": "kimchy"}
+
+	for _, tuple := range []struct {
+		f        es.Fireable
+		expected string
+	}{
+		{es.SearchRequest{Query: es.QueryWrapper(es.MatchAllQuery())}, "application/json"},
+		{es.SearchRequest{}, ""}, // no body
+		{es.MultiSearchRequest{Requests: []es.SearchRequest{{}}}, "application/x-ndjson"},
+		{es.DeleteByQueryRequest{Params: es.SearchParams{Indices: []string{"twitter"}}, Query: es.MatchAllQuery()}, "application/json"},
+		{es.UpdateByQueryRequest{Indices: []string{"twitter"}, Query: es.MatchAllQuery()}, "application/json"},
+		{es.IndexRequest{p, doc}, "application/json"},
+		{es.CreateRequest{p, doc}, "application/json"},
+		{es.UpdateRequest{p, es.UpdateSource{Doc: doc}}, "application/json"},
+		{es.DeleteRequest{p}, ""}, // no body
+		{es.BulkRequest{Requests: []es.BulkIndexable{es.IndexRequest{p, doc}}}, "application/x-ndjson"},
+		{es.RawRequest{Method: "POST", Path: "/_refresh", Body: strings.NewReader(`{}`)}, "application/json"},
+		{es.RawRequest{Method: "GET", Path: "/_stats"}, ""}, // no body
+	} {
+		request, err := tuple.f.Request(&url.URL{})
+		if err != nil {
+			t.Fatalf("%T: %s", tuple.f, err)
+		}
+
+		if expected, got := tuple.expected, request.Header.Get("Content-Type"); expected != got {
+			t.Errorf("%T %s: expected Content-Type = %q; got %q", tuple.f, request.URL.Path, expected, got)
+		}
+	}
+}
+
+func TestRawRequest(t *testing.T) {
+	request, err := es.RawRequest{
+		Method: "PUT",
+		Path:   "/twitter/_settings",
+		Query:  url.Values{"master_timeout": []string{"10s"}},
+		Body:   strings.NewReader(`{"index":{"number_of_replicas":2}}`),
+	}.Request(&url.URL{Scheme: "http", Host: "localhost:9200"})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expected, got := "PUT", request.Method; expected != got {
+		t.Errorf("expected method = %q; got %q", expected, got)
+	}
+
+	if expected, got := "http://localhost:9200/twitter/_settings?master_timeout=10s", request.URL.String(); expected != got {
+		t.Errorf("expected URL = %q; got %q", expected, got)
+	}
+
+	body, err := ioutil.ReadAll(request.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expected, got := `{"index":{"number_of_replicas":2}}`, string(body); expected != got {
+		t.Errorf("expected body = %q; got %q", expected, got)
+	}
+}
+
+func TestDeleteByQueryRequest(t *testing.T) {
+	request, err := es.DeleteByQueryRequest{
+		Params: es.SearchParams{
+			Indices: []string{"twitter"},
+			Types:   []string{"tweet"},
+			Routing: "kimchy",
+		},
+		Query: es.TermQuery(es.TermQueryParams{
+			Query: &es.Wrapper{Name: "user", Wrapped: "kimchy"},
+		}),
+	}.Request(&url.URL{})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expected, got := "POST", request.Method; expected != got {
+		t.Errorf("expected method = %q; got %q", expected, got)
+	}
+
+	if expected, got := "/twitter/tweet/_delete_by_query", request.URL.Path; expected != got {
+		t.Errorf("expected path = %q; got %q", expected, got)
+	}
+
+	if expected, got := "kimchy", request.URL.Query().Get("routing"); expected != got {
+		t.Errorf("expected routing = %q; got %q", expected, got)
+	}
+
+	body, err := ioutil.ReadAll(request.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expected, got := `{"query":{"term":{"user":"kimchy"}}}`+"\n", string(body); expected != got {
+		t.Errorf("expected body = %q; got %q", expected, got)
+	}
+}
+
+func TestExplainRequest(t *testing.T) {
+	request, err := es.ExplainRequest{
+		Index: "twitter",
+		Type:  "tweet",
+		Id:    "1",
+		Query: es.FieldMatch("message", "search"),
+	}.Request(&url.URL{})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expected, got := "POST", request.Method; expected != got {
+		t.Errorf("expected method = %q; got %q", expected, got)
+	}
+
+	if expected, got := "/twitter/tweet/1/_explain", request.URL.Path; expected != got {
+		t.Errorf("expected path = %q; got %q", expected, got)
+	}
+
+	body, err := ioutil.ReadAll(request.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expected, got := `{"query":{"match":{"message":"search"}}}`+"\n", string(body); expected != got {
+		t.Errorf("expected body = %q; got %q", expected, got)
+	}
+
+	if _, err := (es.ExplainRequest{Index: "twitter", Type: "tweet"}).Request(&url.URL{}); err == nil {
+		t.Errorf("expected error with no id, got none")
+	}
+}
+
+func TestValidateQueryRequest(t *testing.T) {
+	for _, tuple := range []struct {
+		r     es.ValidateQueryRequest
+		path  string
+		query string
+	}{
+		{
+			r:    es.ValidateQueryRequest{Query: es.MatchAllQuery()},
+			path: "/_validate/query",
+		},
+		{
+			r:     es.ValidateQueryRequest{Indices: []string{"twitter"}, Query: es.FieldMatch("message", "search"), Explain: true},
+			path:  "/twitter/_validate/query",
+			query: "explain=true",
+		},
+	} {
+		request, err := tuple.r.Request(&url.URL{})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if expected, got := tuple.path, request.URL.Path; expected != got {
+			t.Errorf("expected path = %q; got %q", expected, got)
+		}
+
+		if expected, got := tuple.query, request.URL.RawQuery; expected != got {
+			t.Errorf("expected query = %q; got %q", expected, got)
+		}
+
+		var body map[string]json.RawMessage
+		if err := json.NewDecoder(request.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+
+		if expected, got := marshalOrError(tuple.r.Query), string(body["query"]); expected != got {
+			t.Errorf("expected query body = %s; got %s", expected, got)
+		}
+	}
+}
+
+func TestDeleteByQueryRequestRequired(t *testing.T) {
+	query := es.TermQuery(es.TermQueryParams{
+		Query: &es.Wrapper{Name: "user", Wrapped: "kimchy"},
+	})
+
+	if _, err := (es.DeleteByQueryRequest{Query: query}).Request(&url.URL{}); err == nil {
+		t.Errorf("expected error with no indices, got none")
+	}
+
+	params := es.SearchParams{Indices: []string{"twitter"}}
+	if _, err := (es.DeleteByQueryRequest{Params: params}).Request(&url.URL{}); err == nil {
+		t.Errorf("expected error with no query, got none")
+	}
+}
+
+func TestUpdateByQueryRequest(t *testing.T) {
+	request, err := es.UpdateByQueryRequest{
+		Indices: []string{"twitter", "blog"},
+		Query: es.TermQuery(es.TermQueryParams{
+			Query: &es.Wrapper{Name: "user", Wrapped: "kimchy"},
+		}),
+		Script: "ctx._source.likes += params.n",
+		Params: map[string]interface{}{"n": 1},
+	}.Request(&url.URL{})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expected, got := "POST", request.Method; expected != got {
+		t.Errorf("expected method = %q; got %q", expected, got)
+	}
+
+	if expected, got := "/twitter,blog/_update_by_query", request.URL.Path; expected != got {
+		t.Errorf("expected path = %q; got %q", expected, got)
+	}
+
+	body, err := ioutil.ReadAll(request.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expected, got := `{"query":{"term":{"user":"kimchy"}},"script":{"source":"ctx._source.likes += params.n","params":{"n":1}}}`+"\n", string(body); expected != got {
+		t.Errorf("expected body = %q; got %q", expected, got)
+	}
+
+	if _, err := (es.UpdateByQueryRequest{Script: "ctx._source.likes++"}).Request(&url.URL{}); err == nil {
+		t.Errorf("expected error with no indices, got none")
+	}
+}
+
+func TestSearchRequestSuggest(t *testing.T) {
+	request, err := es.SearchRequest{
+		Suggest: es.Suggest{
+			{
+				Name:      "spelling",
+				Text:      "kimchy trying out",
+				Suggester: es.TermSuggester(es.TermSuggesterParams{Field: "message", SuggestMode: "popular"}),
+			},
+			{
+				Name:      "phrasing",
+				Text:      "trying ot elastic",
+				Suggester: es.PhraseSuggester(es.PhraseSuggesterParams{Field: "message", GramSize: 3}),
+			},
+		},
+	}.Request(&url.URL{})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var body map[string]json.RawMessage
+	if err := json.NewDecoder(request.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+
+	if expected, got := `{"phrasing":{"phrase":{"field":"message","gram_size":3},"text":"trying ot elastic"},"spelling":{"term":{"field":"message","suggest_mode":"popular"},"text":"kimchy trying out"}}`, string(body["suggest"]); expected != got {
+		t.Errorf("expected suggest = %s; got %s", expected, got)
+	}
+}
+
+func TestSuggestWithoutSuggester(t *testing.T) {
+	_, err := json.Marshal(es.Suggest{{Name: "spelling", Text: "kimchy"}})
+	if err == nil {
+		t.Fatalf("expected error marshaling a suggester without a type, got none")
+	}
+	if expected, got := `suggester "spelling": no suggester type`, err.Error(); !strings.Contains(got, expected) {
+		t.Errorf("expected error to contain %q; got %q", expected, got)
+	}
+}
+
+func TestSearchRequestHighlight(t *testing.T) {
+	for _, tuple := range []struct {
+		config   es.HighlightConfig
+		expected string
+	}{
+		{
+			config:   es.HighlightConfig{Fields: []string{"message"}},
+			expected: `{"fields":{"message":{}},"pre_tags":["<em>"],"post_tags":["</em>"],"fragment_size":100,"number_of_fragments":5}`,
+		},
+		{
+			config: es.HighlightConfig{
+				Fields:            []string{"message", "user"},
+				PreTags:           []string{"<b>"},
+				PostTags:          []string{"</b>"},
+				FragmentSize:      150,
+				NumberOfFragments: 3,
+				RequireFieldMatch: true,
+			},
+			expected: `{"fields":{"message":{},"user":{}},"pre_tags":["<b>"],"post_tags":["</b>"],"fragment_size":150,"number_of_fragments":3,"require_field_match":true}`,
+		},
+	} {
+		config := tuple.config
+		request, err := es.SearchRequest{
+			Query:     es.QueryWrapper(es.MatchAllQuery()),
+			Highlight: &config,
+		}.Request(&url.URL{})
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var body map[string]json.RawMessage
+		if err := json.NewDecoder(request.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+
+		unescape := strings.NewReplacer(`\u003c`, "<", `\u003e`, ">")
+		if expected, got := tuple.expected, unescape.Replace(string(body["highlight"])); expected != got {
+			t.Errorf("expected highlight = %s; got %s", expected, got)
+		}
+	}
+}
+
+func TestReindexRequest(t *testing.T) {
+	request, err := es.ReindexRequest{
+		SourceIndex: "twitter",
+		DestIndex:   "new_twitter",
+		Query: es.TermQuery(es.TermQueryParams{
+			Query: &es.Wrapper{Name: "user", Wrapped: "kimchy"},
+		}),
+		Script: "ctx._source.remove('likes')",
+	}.Request(&url.URL{})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expected, got := "POST", request.Method; expected != got {
+		t.Errorf("expected method = %q; got %q", expected, got)
+	}
+
+	if expected, got := "/_reindex", request.URL.Path; expected != got {
+		t.Errorf("expected path = %q; got %q", expected, got)
+	}
+
+	body, err := ioutil.ReadAll(request.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expected, got := `{"source":{"index":"twitter","query":{"term":{"user":"kimchy"}}},"dest":{"index":"new_twitter"},"script":{"source":"ctx._source.remove('likes')"}}`+"\n", string(body); expected != got {
+		t.Errorf("expected body = %q; got %q", expected, got)
+	}
+
+	for _, r := range []es.ReindexRequest{
+		{DestIndex: "new_twitter"},
+		{SourceIndex: "twitter"},
+	} {
+		if _, err := r.Request(&url.URL{}); err == nil {
+			t.Errorf("%+v: expected error, got none", r)
+		}
+	}
+}
@@ -1,38 +1,540 @@
 package elasticsearch
 
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
 // SearchResponse represents the response given by ElasticSearch from a search
 // query.
 type SearchResponse struct {
 	Took int `json:"took"` // ms
 
-	HitsWrapper struct {
-		Total int `json:"total"`
-		Hits  []struct {
-			Index string   `json:"_index"`
-			Type  string   `json:"_type"`
-			ID    string   `json:"_id"`
-			Score *float64 `json:"_score"` // can be 'null' with constant_score
-		} `json:"hits,omitempty"`
-	} `json:"hits"`
+	HitsWrapper SearchHits `json:"hits"`
+
+	Facets       map[string]FacetResponse   `json:"facets,omitempty"`
+	Aggregations map[string]json.RawMessage `json:"aggregations,omitempty"`
+	Suggest      map[string]json.RawMessage `json:"suggest,omitempty"`
+
+	TimedOut        bool   `json:"timed_out,omitempty"`
+	TerminatedEarly bool   `json:"terminated_early,omitempty"`
+	Error           string `json:"error,omitempty"`
+	Status          int    `json:"status,omitempty"`
+
+	// Extra holds the top-level keys of the response that don't correspond
+	// to any other field, eg. _shards, so they're retained rather than
+	// dropped.
+	Extra map[string]json.RawMessage `json:"-"`
+}
+
+// UnmarshalJSON accepts the error as either a string, or the structured
+// object returned by newer versions of ElasticSearch, which is flattened into
+// a string by errorString.
+func (r *SearchResponse) UnmarshalJSON(data []byte) error {
+	type response SearchResponse // without this method, to avoid recursion
+	aux := struct {
+		*response
+		Error json.RawMessage `json:"error,omitempty"` // shadows response.Error
+	}{
+		response: (*response)(r),
+	}
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+	r.Error = errorString(aux.Error)
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+
+	known := jsonKeys(reflect.TypeOf(*r))
+	for key, value := range fields {
+		if known[key] {
+			continue
+		}
+		if r.Extra == nil {
+			r.Extra = map[string]json.RawMessage{}
+		}
+		r.Extra[key] = value
+	}
+
+	return nil
+}
+
+// SearchHits are the hits of a SearchResponse. TotalRelation is "eq" if Total
+// is exact, or "gte" if it's a lower bound; older versions of ElasticSearch
+// always give an exact Total.
+type SearchHits struct {
+	Total         int    `json:"total"`
+	TotalRelation string `json:"-"`
+	Hits          []Hit  `json:"hits,omitempty"`
+}
+
+// UnmarshalJSON accepts the total as either a bare number, or an object of
+// the form `{"value": 100, "relation": "eq"}`.
+func (h *SearchHits) UnmarshalJSON(data []byte) error {
+	var hits struct {
+		Total json.RawMessage `json:"total"`
+		Hits  []Hit           `json:"hits"`
+	}
+	if err := json.Unmarshal(data, &hits); err != nil {
+		return err
+	}
 
-	Facets map[string]FacetResponse `json:"facets,omitempty"`
+	*h = SearchHits{Hits: hits.Hits}
 
-	TimedOut bool   `json:"timed_out,omitempty"`
-	Error    string `json:"error,omitempty"`
-	Status   int    `json:"status,omitempty"`
+	trimmed := bytes.TrimSpace(hits.Total)
+	switch {
+	case len(trimmed) <= 0 || bytes.Equal(trimmed, []byte("null")):
+		return nil
+
+	case trimmed[0] == '{':
+		var total struct {
+			Value    int    `json:"value"`
+			Relation string `json:"relation"`
+		}
+		if err := json.Unmarshal(trimmed, &total); err != nil {
+			return fmt.Errorf("hits total: %s", err)
+		}
+		h.Total, h.TotalRelation = total.Value, total.Relation
+
+	default:
+		if err := json.Unmarshal(trimmed, &h.Total); err != nil {
+			return fmt.Errorf("hits total: %s", err)
+		}
+		h.TotalRelation = "eq"
+	}
+	return nil
+}
+
+// HitMeta identifies the document behind a Hit.
+type HitMeta struct {
+	Index   string
+	Type    string
+	ID      string
+	Score   *float64
+	Version int
 }
 
+// EachSource calls fn with the metadata and _source of each hit, in order. If
+// fn returns an error, iteration stops, and EachSource returns that error.
+func (r SearchResponse) EachSource(fn func(meta HitMeta, raw json.RawMessage) error) error {
+	for _, hit := range r.HitsWrapper.Hits {
+		meta := HitMeta{
+			Index:   hit.Index,
+			Type:    hit.Type,
+			ID:      hit.ID,
+			Score:   hit.Score,
+			Version: hit.Version,
+		}
+		if err := fn(meta, hit.Source); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DecodeAll unmarshals the _source of every hit into dst, which must be a
+// pointer to a slice. Decoded sources are appended to the slice, in order. It
+// returns an error if any hit has no _source, eg. because it was excluded by
+// the request.
+func (r SearchResponse) DecodeAll(dst interface{}) error {
+	v := reflect.ValueOf(dst)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Slice {
+		return fmt.Errorf("decode all: expected a pointer to a slice; got %T", dst)
+	}
+	slice := v.Elem()
+
+	return r.EachSource(func(meta HitMeta, raw json.RawMessage) error {
+		if len(raw) <= 0 {
+			return fmt.Errorf("decode all: hit %s/%s/%s has no _source", meta.Index, meta.Type, meta.ID)
+		}
+		elem := reflect.New(slice.Type().Elem())
+		if err := json.Unmarshal(raw, elem.Interface()); err != nil {
+			return fmt.Errorf("decode all: hit %s/%s/%s: %s", meta.Index, meta.Type, meta.ID, err)
+		}
+		slice.Set(reflect.Append(slice, elem.Elem()))
+		return nil
+	})
+}
+
+// errorString returns a readable error from the raw value of an "error" key,
+// which may be a string, or an object with a type and reason.
+func errorString(raw json.RawMessage) string {
+	if len(raw) <= 0 || string(raw) == "null" {
+		return ""
+	}
+
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		return s
+	}
+
+	var structured struct {
+		Type   string `json:"type"`
+		Reason string `json:"reason"`
+	}
+	if err := json.Unmarshal(raw, &structured); err == nil && structured.Reason != "" {
+		if structured.Type == "" {
+			return structured.Reason
+		}
+		return structured.Type + ": " + structured.Reason
+	}
+
+	return string(raw)
+}
+
+// unmarshalWithError decodes data into v, except for its "error" key, which
+// may be a string or an object, and is flattened into dst by errorString. It's
+// for the UnmarshalJSON methods of responses, so v must be of a type without
+// that method, to avoid recursion.
+func unmarshalWithError(data []byte, v interface{}, dst *string) error {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	raw := fields["error"]
+	delete(fields, "error")
+
+	rest, err := json.Marshal(fields)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(rest, v); err != nil {
+		return err
+	}
+
+	*dst = errorString(raw)
+	return nil
+}
+
+// jsonKeys returns the set of keys that the struct type's fields are
+// marshaled to and from.
+func jsonKeys(t reflect.Type) map[string]bool {
+	keys := map[string]bool{}
+	for i := 0; i < t.NumField(); i++ {
+		tag := t.Field(i).Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		if name := strings.Split(tag, ",")[0]; name != "" {
+			keys[name] = true
+		} else {
+			keys[t.Field(i).Name] = true
+		}
+	}
+	return keys
+}
+
+// Hit is a single document matched by a search.
+type Hit struct {
+	Index string   `json:"_index"`
+	Type  string   `json:"_type"`
+	ID    string   `json:"_id"`
+	Score *float64 `json:"_score"` // can be 'null' with constant_score
+
+	Source      json.RawMessage            `json:"_source,omitempty"`
+	Fields      map[string]json.RawMessage `json:"fields,omitempty"`
+	Version     int                        `json:"_version,omitempty"`
+	Explanation json.RawMessage            `json:"_explanation,omitempty"`
+	Highlight   map[string][]string        `json:"highlight,omitempty"`
+	Sort        []interface{}              `json:"sort,omitempty"` // per SearchRequest.Sort
+}
+
+// FacetResponse is a single facet of a SearchResponse. Facets of different
+// types have different shapes, so the facet is kept as Raw JSON, to be decoded
+// by the As method for its Type, eg. AsTerms for "terms". For compatibility,
+// the fields of a terms facet are also decoded directly into FacetResponse.
 type FacetResponse struct {
-	Type    string `json:"_type"`
-	Missing int64  `json:"missing"`
-	Total   int64  `json:"total"`
-	Other   int64  `json:"other"`
-	Terms   []struct {
-		Term  string `json:"term"`
-		Count int64  `json:"count"`
-	} `json:"terms"`
+	Type    string      `json:"_type"`
+	Missing int64       `json:"missing"`
+	Total   int64       `json:"total"`
+	Other   int64       `json:"other"`
+	Terms   []FacetTerm `json:"terms"`
+
+	Raw json.RawMessage `json:"-"`
+}
+
+func (r *FacetResponse) UnmarshalJSON(data []byte) error {
+	var header struct {
+		Type string `json:"_type"`
+	}
+	if err := json.Unmarshal(data, &header); err != nil {
+		return err
+	}
+
+	*r = FacetResponse{
+		Type: header.Type,
+		Raw:  append(json.RawMessage{}, data...),
+	}
+
+	if r.Type != "terms" {
+		return nil
+	}
+
+	terms, err := r.AsTerms()
+	if err != nil {
+		return err
+	}
+	r.Missing, r.Total, r.Other, r.Terms = terms.Missing, terms.Total, terms.Other, terms.Terms
+	return nil
+}
+
+// as decodes the Raw facet into v, if the facet is one of the given types.
+func (r FacetResponse) as(v interface{}, types ...string) error {
+	for _, t := range types {
+		if r.Type == t {
+			return json.Unmarshal(r.Raw, v)
+		}
+	}
+	return fmt.Errorf("facet of type %q is not %s", r.Type, strings.Join(types, " or "))
+}
+
+type FacetTerm struct {
+	Term  string `json:"term"`
+	Count int64  `json:"count"`
+}
+
+type TermsFacetResponse struct {
+	Missing int64       `json:"missing"`
+	Total   int64       `json:"total"`
+	Other   int64       `json:"other"`
+	Terms   []FacetTerm `json:"terms"`
+}
+
+// AsTerms decodes a terms facet.
+func (r FacetResponse) AsTerms() (response TermsFacetResponse, err error) {
+	err = r.as(&response, "terms")
+	return
+}
+
+type FacetRange struct {
+	From       float64 `json:"from"`
+	To         float64 `json:"to"`
+	Count      int64   `json:"count"`
+	TotalCount int64   `json:"total_count"`
+	Min        float64 `json:"min"`
+	Max        float64 `json:"max"`
+	Total      float64 `json:"total"`
+	Mean       float64 `json:"mean"`
+}
+
+type RangeFacetResponse struct {
+	Ranges []FacetRange `json:"ranges"`
+}
+
+// AsRange decodes a range facet, or a geo_distance facet, which has the same
+// shape.
+func (r FacetResponse) AsRange() (response RangeFacetResponse, err error) {
+	err = r.as(&response, "range", "geo_distance")
+	return
+}
+
+type StatisticalFacetResponse struct {
+	Count        int64   `json:"count"`
+	Total        float64 `json:"total"`
+	Min          float64 `json:"min"`
+	Max          float64 `json:"max"`
+	Mean         float64 `json:"mean"`
+	SumOfSquares float64 `json:"sum_of_squares"`
+	Variance     float64 `json:"variance"`
+	StdDeviation float64 `json:"std_deviation"`
+}
+
+// AsStatistical decodes a statistical facet.
+func (r FacetResponse) AsStatistical() (response StatisticalFacetResponse, err error) {
+	err = r.as(&response, "statistical")
+	return
+}
+
+// RangeAggResponse is the result of a RangeAgg: a bucket for each range, in
+// the order they were requested.
+type RangeAggResponse struct {
+	Buckets []RangeBucket `json:"buckets"`
+}
+
+// RangeBucket is one range of a RangeAgg. From and To are nil for unbounded
+// ends. Sub-aggregations computed within the bucket are kept as raw JSON.
+type RangeBucket struct {
+	Key      string   `json:"key"`
+	From     *float64 `json:"from"`
+	To       *float64 `json:"to"`
+	DocCount int64    `json:"doc_count"`
+
+	Aggregations map[string]json.RawMessage `json:"-"`
+}
+
+func (b *RangeBucket) UnmarshalJSON(data []byte) error {
+	type bucket RangeBucket // without this method, to avoid recursion
+	if err := json.Unmarshal(data, (*bucket)(b)); err != nil {
+		return err
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	for key, value := range fields {
+		switch key {
+		case "key", "from", "from_as_string", "to", "to_as_string", "doc_count":
+			continue
+		}
+		if b.Aggregations == nil {
+			b.Aggregations = map[string]json.RawMessage{}
+		}
+		b.Aggregations[key] = value
+	}
+	return nil
+}
+
+// RangeAgg decodes the named aggregation, which should be a RangeAgg.
+func (r SearchResponse) RangeAgg(name string) (response RangeAggResponse, err error) {
+	raw, ok := r.Aggregations[name]
+	if !ok {
+		return response, fmt.Errorf("no aggregation named %q", name)
+	}
+	err = json.Unmarshal(raw, &response)
+	return
 }
 
 type MultiSearchResponse struct {
 	Responses []SearchResponse `json:"responses"`
 }
+
+// UnmarshalJSON decodes each response independently. A response which can't
+// be decoded doesn't fail the others: it's recorded as a SearchResponse with
+// only an Error.
+func (r *MultiSearchResponse) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		Responses []json.RawMessage `json:"responses"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	r.Responses = make([]SearchResponse, len(raw.Responses))
+	for i, data := range raw.Responses {
+		if err := json.Unmarshal(data, &r.Responses[i]); err != nil {
+			r.Responses[i] = SearchResponse{Error: fmt.Sprintf("decode response: %s", err)}
+		}
+	}
+	return nil
+}
+
+// FirstError returns an error describing the first sub-search which failed,
+// or nil if they all succeeded.
+func (r MultiSearchResponse) FirstError() error {
+	for i, response := range r.Responses {
+		if response.Error != "" {
+			return fmt.Errorf("search %d: %s (status %d)", i, response.Error, response.Status)
+		}
+	}
+	return nil
+}
+
+// Succeeded returns the sub-search responses which didn't fail, in order.
+func (r MultiSearchResponse) Succeeded() []SearchResponse {
+	succeeded := []SearchResponse{}
+	for _, response := range r.Responses {
+		if response.Error == "" {
+			succeeded = append(succeeded, response)
+		}
+	}
+	return succeeded
+}
+
+type DeleteByQueryResponse struct {
+	Took             int               `json:"took"` // ms
+	TimedOut         bool              `json:"timed_out"`
+	Total            int               `json:"total"`
+	Deleted          int               `json:"deleted"`
+	VersionConflicts int               `json:"version_conflicts"`
+	Failures         []json.RawMessage `json:"failures,omitempty"`
+
+	Error  string `json:"error,omitempty"`
+	Status int    `json:"status,omitempty"`
+}
+
+// UnmarshalJSON accepts the error as either a string, or an object.
+func (r *DeleteByQueryResponse) UnmarshalJSON(data []byte) error {
+	type response DeleteByQueryResponse // without this method, to avoid recursion
+	return unmarshalWithError(data, (*response)(r), &r.Error)
+}
+
+type UpdateByQueryResponse struct {
+	Took             int               `json:"took"` // ms
+	TimedOut         bool              `json:"timed_out"`
+	Total            int               `json:"total"`
+	Updated          int               `json:"updated"`
+	VersionConflicts int               `json:"version_conflicts"`
+	Failures         []json.RawMessage `json:"failures,omitempty"`
+
+	Error  string `json:"error,omitempty"`
+	Status int    `json:"status,omitempty"`
+}
+
+// UnmarshalJSON accepts the error as either a string, or an object.
+func (r *UpdateByQueryResponse) UnmarshalJSON(data []byte) error {
+	type response UpdateByQueryResponse // without this method, to avoid recursion
+	return unmarshalWithError(data, (*response)(r), &r.Error)
+}
+
+type ExplainResponse struct {
+	Index       string          `json:"_index"`
+	Type        string          `json:"_type"`
+	ID          string          `json:"_id"`
+	Matched     bool            `json:"matched"`
+	Explanation json.RawMessage `json:"explanation,omitempty"`
+
+	Error  string `json:"error,omitempty"`
+	Status int    `json:"status,omitempty"`
+}
+
+// UnmarshalJSON accepts the error as either a string, or an object.
+func (r *ExplainResponse) UnmarshalJSON(data []byte) error {
+	type response ExplainResponse // without this method, to avoid recursion
+	return unmarshalWithError(data, (*response)(r), &r.Error)
+}
+
+// ValidateQueryResponse has Explanations only if they were requested.
+type ValidateQueryResponse struct {
+	Valid        bool `json:"valid"`
+	Explanations []struct {
+		Index       string `json:"index"`
+		Valid       bool   `json:"valid"`
+		Error       string `json:"error,omitempty"`
+		Explanation string `json:"explanation,omitempty"`
+	} `json:"explanations,omitempty"`
+
+	Error  string `json:"error,omitempty"`
+	Status int    `json:"status,omitempty"`
+}
+
+// UnmarshalJSON accepts the error as either a string, or an object.
+func (r *ValidateQueryResponse) UnmarshalJSON(data []byte) error {
+	type response ValidateQueryResponse // without this method, to avoid recursion
+	return unmarshalWithError(data, (*response)(r), &r.Error)
+}
+
+type ReindexResponse struct {
+	Took             int               `json:"took"` // ms
+	TimedOut         bool              `json:"timed_out"`
+	Total            int               `json:"total"`
+	Created          int               `json:"created"`
+	Updated          int               `json:"updated"`
+	VersionConflicts int               `json:"version_conflicts"`
+	Failures         []json.RawMessage `json:"failures,omitempty"`
+
+	Error  string `json:"error,omitempty"`
+	Status int    `json:"status,omitempty"`
+}
+
+// UnmarshalJSON accepts the error as either a string, or an object.
+func (r *ReindexResponse) UnmarshalJSON(data []byte) error {
+	type response ReindexResponse // without this method, to avoid recursion
+	return unmarshalWithError(data, (*response)(r), &r.Error)
+}
@@ -0,0 +1,743 @@
+package elasticsearch_test
+
+import (
+	"encoding/json"
+	"fmt"
+	es "github.com/peterbourgon/elasticsearch"
+	"testing"
+)
+
+func TestSearchResponseAggregations(t *testing.T) {
+	data := []byte(`{
+		"took": 3,
+		"hits": {"total": 3, "hits": []},
+		"aggregations": {
+			"users": {
+				"buckets": [
+					{"key": "kimchy", "doc_count": 2},
+					{"key": "bob", "doc_count": 1}
+				]
+			}
+		}
+	}`)
+
+	var response es.SearchResponse
+	if err := json.Unmarshal(data, &response); err != nil {
+		t.Fatal(err)
+	}
+
+	raw, ok := response.Aggregations["users"]
+	if !ok {
+		t.Fatal("users aggregation was not decoded")
+	}
+
+	var users struct {
+		Buckets []struct {
+			Key      string `json:"key"`
+			DocCount int    `json:"doc_count"`
+		} `json:"buckets"`
+	}
+	if err := json.Unmarshal(raw, &users); err != nil {
+		t.Fatal(err)
+	}
+
+	if expected, got := 2, len(users.Buckets); expected != got {
+		t.Fatalf("expected %d bucket(s); got %d", expected, got)
+	}
+
+	if expected, got := "kimchy", users.Buckets[0].Key; expected != got {
+		t.Errorf("expected key = %q; got %q", expected, got)
+	}
+
+	if expected, got := 2, users.Buckets[0].DocCount; expected != got {
+		t.Errorf("expected doc_count = %d; got %d", expected, got)
+	}
+}
+
+func TestSearchResponseHitFields(t *testing.T) {
+	data := []byte(`{
+		"took": 1,
+		"hits": {
+			"total": 1,
+			"hits": [
+				{
+					"_index": "twitter",
+					"_type": "tweet",
+					"_id": "1",
+					"_score": 1.0,
+					"fields": {"user": "kimchy", "post_date": "2009-11-15T14:12:12"}
+				}
+			]
+		}
+	}`)
+
+	var response es.SearchResponse
+	if err := json.Unmarshal(data, &response); err != nil {
+		t.Fatal(err)
+	}
+
+	if expected, got := 1, len(response.HitsWrapper.Hits); expected != got {
+		t.Fatalf("expected %d hit(s); got %d", expected, got)
+	}
+
+	hit := response.HitsWrapper.Hits[0]
+
+	if expected, got := `"kimchy"`, string(hit.Fields["user"]); expected != got {
+		t.Errorf("expected user = %s; got %s", expected, got)
+	}
+
+	if expected, got := `"2009-11-15T14:12:12"`, string(hit.Fields["post_date"]); expected != got {
+		t.Errorf("expected post_date = %s; got %s", expected, got)
+	}
+}
+
+func TestSearchResponseTimedOut(t *testing.T) {
+	data := []byte(`{"took":500,"timed_out":true,"terminated_early":true,"hits":{"total":0,"hits":[]}}`)
+
+	var response es.SearchResponse
+	if err := json.Unmarshal(data, &response); err != nil {
+		t.Fatal(err)
+	}
+
+	if !response.TimedOut {
+		t.Errorf("expected timed_out = true")
+	}
+
+	if !response.TerminatedEarly {
+		t.Errorf("expected terminated_early = true")
+	}
+}
+
+func TestSearchResponseHitExplanation(t *testing.T) {
+	data := []byte(`{
+		"took": 1,
+		"hits": {
+			"total": 1,
+			"hits": [
+				{
+					"_index": "twitter",
+					"_type": "tweet",
+					"_id": "1",
+					"_score": 0.30685282,
+					"_version": 3,
+					"_explanation": {"value": 0.30685282, "description": "fieldWeight", "details": []}
+				}
+			]
+		}
+	}`)
+
+	var response es.SearchResponse
+	if err := json.Unmarshal(data, &response); err != nil {
+		t.Fatal(err)
+	}
+
+	hit := response.HitsWrapper.Hits[0]
+
+	if expected, got := 3, hit.Version; expected != got {
+		t.Errorf("expected _version = %d; got %d", expected, got)
+	}
+
+	var explanation struct {
+		Description string `json:"description"`
+	}
+	if err := json.Unmarshal(hit.Explanation, &explanation); err != nil {
+		t.Fatal(err)
+	}
+
+	if expected, got := "fieldWeight", explanation.Description; expected != got {
+		t.Errorf("expected description = %q; got %q", expected, got)
+	}
+}
+
+func TestDeleteByQueryResponse(t *testing.T) {
+	data := []byte(`{"took":147,"timed_out":false,"total":119,"deleted":119,"batches":1,"version_conflicts":0,"failures":[]}`)
+
+	var response es.DeleteByQueryResponse
+	if err := json.Unmarshal(data, &response); err != nil {
+		t.Fatal(err)
+	}
+
+	if expected, got := 119, response.Deleted; expected != got {
+		t.Errorf("expected deleted = %d; got %d", expected, got)
+	}
+}
+
+func TestUpdateByQueryResponse(t *testing.T) {
+	data := []byte(`{"took":147,"timed_out":false,"total":5,"updated":4,"batches":1,"version_conflicts":1,"failures":[]}`)
+
+	var response es.UpdateByQueryResponse
+	if err := json.Unmarshal(data, &response); err != nil {
+		t.Fatal(err)
+	}
+
+	if expected, got := 4, response.Updated; expected != got {
+		t.Errorf("expected updated = %d; got %d", expected, got)
+	}
+
+	if expected, got := 1, response.VersionConflicts; expected != got {
+		t.Errorf("expected version_conflicts = %d; got %d", expected, got)
+	}
+}
+
+func TestByQueryResponseStructuredError(t *testing.T) {
+	data := []byte(`{"error":{"root_cause":[{"type":"index_not_found_exception","reason":"no such index"}],"type":"index_not_found_exception","reason":"no such index","index":"twitter"},"status":404}`)
+
+	var deleted es.DeleteByQueryResponse
+	var updated es.UpdateByQueryResponse
+	var reindexed es.ReindexResponse
+	for _, tuple := range []struct {
+		response interface{}
+		error    *string
+		status   *int
+	}{
+		{&deleted, &deleted.Error, &deleted.Status},
+		{&updated, &updated.Error, &updated.Status},
+		{&reindexed, &reindexed.Error, &reindexed.Status},
+	} {
+		if err := json.Unmarshal(data, tuple.response); err != nil {
+			t.Errorf("%T: %s", tuple.response, err)
+			continue
+		}
+		if expected, got := "index_not_found_exception: no such index", *tuple.error; expected != got {
+			t.Errorf("%T: expected error = %q; got %q", tuple.response, expected, got)
+		}
+		if expected, got := 404, *tuple.status; expected != got {
+			t.Errorf("%T: expected status = %d; got %d", tuple.response, expected, got)
+		}
+	}
+}
+
+func TestResponsesStructuredError(t *testing.T) {
+	data := []byte(`{"error":{"type":"index_not_found_exception","reason":"no such index"},"status":404}`)
+
+	var (
+		acknowledged es.AcknowledgedResponse
+		get          es.GetResponse
+		termVectors  es.TermVectorsResponse
+		explain      es.ExplainResponse
+		validate     es.ValidateQueryResponse
+		indexStats   es.IndexStatsResponse
+	)
+	for _, tuple := range []struct {
+		response interface{}
+		error    *string
+	}{
+		{&acknowledged, &acknowledged.Error},
+		{&get, &get.Error},
+		{&termVectors, &termVectors.Error},
+		{&explain, &explain.Error},
+		{&validate, &validate.Error},
+		{&indexStats, &indexStats.Error},
+	} {
+		if err := json.Unmarshal(data, tuple.response); err != nil {
+			t.Errorf("%T: %s", tuple.response, err)
+			continue
+		}
+		if expected, got := "index_not_found_exception: no such index", *tuple.error; expected != got {
+			t.Errorf("%T: expected error = %q; got %q", tuple.response, expected, got)
+		}
+	}
+
+	if expected, got := 404, get.Status; expected != got {
+		t.Errorf("expected status = %d; got %d", expected, got)
+	}
+}
+
+func TestSearchResponseSuggest(t *testing.T) {
+	data := []byte(`{
+		"took": 5,
+		"hits": {"total": 0, "hits": []},
+		"suggest": {
+			"spelling": [
+				{
+					"text": "kimchi",
+					"offset": 0,
+					"length": 6,
+					"options": [
+						{"text": "kimchy", "score": 0.8333333, "freq": 3}
+					]
+				}
+			]
+		}
+	}`)
+
+	var response es.SearchResponse
+	if err := json.Unmarshal(data, &response); err != nil {
+		t.Fatal(err)
+	}
+
+	var entries []struct {
+		Text    string `json:"text"`
+		Options []struct {
+			Text string `json:"text"`
+			Freq int    `json:"freq"`
+		} `json:"options"`
+	}
+	if err := json.Unmarshal(response.Suggest["spelling"], &entries); err != nil {
+		t.Fatal(err)
+	}
+
+	if expected, got := 1, len(entries); expected != got {
+		t.Fatalf("expected %d entries; got %d", expected, got)
+	}
+
+	if expected, got := 1, len(entries[0].Options); expected != got {
+		t.Fatalf("expected %d option(s); got %d", expected, got)
+	}
+
+	if expected, got := "kimchy", entries[0].Options[0].Text; expected != got {
+		t.Errorf("expected option = %q; got %q", expected, got)
+	}
+
+	if expected, got := 3, entries[0].Options[0].Freq; expected != got {
+		t.Errorf("expected freq = %d; got %d", expected, got)
+	}
+}
+
+func TestSearchResponseHitHighlight(t *testing.T) {
+	data := []byte(`{
+		"took": 1,
+		"hits": {
+			"total": 1,
+			"hits": [
+				{
+					"_index": "twitter",
+					"_type": "tweet",
+					"_id": "1",
+					"_score": 1.0,
+					"highlight": {"message": ["trying out <em>Elastic</em> Search"]}
+				}
+			]
+		}
+	}`)
+
+	var response es.SearchResponse
+	if err := json.Unmarshal(data, &response); err != nil {
+		t.Fatal(err)
+	}
+
+	fragments := response.HitsWrapper.Hits[0].Highlight["message"]
+
+	if expected, got := 1, len(fragments); expected != got {
+		t.Fatalf("expected %d fragment(s); got %d", expected, got)
+	}
+
+	if expected, got := "trying out <em>Elastic</em> Search", fragments[0]; expected != got {
+		t.Errorf("expected fragment = %q; got %q", expected, got)
+	}
+}
+
+func TestSearchResponseExtra(t *testing.T) {
+	data := []byte(`{
+		"took": 1,
+		"timed_out": false,
+		"_shards": {"total": 5, "successful": 5, "failed": 0},
+		"_clusters": {"total": 2, "successful": 2, "skipped": 0},
+		"num_reduce_phases": 2,
+		"hits": {"total": 0, "hits": []}
+	}`)
+
+	var response es.SearchResponse
+	if err := json.Unmarshal(data, &response); err != nil {
+		t.Fatal(err)
+	}
+
+	if expected, got := 1, response.Took; expected != got {
+		t.Errorf("expected took = %d; got %d", expected, got)
+	}
+
+	for key, expected := range map[string]string{
+		"_shards":           `{"total": 5, "successful": 5, "failed": 0}`,
+		"_clusters":         `{"total": 2, "successful": 2, "skipped": 0}`,
+		"num_reduce_phases": `2`,
+	} {
+		if got := string(response.Extra[key]); expected != got {
+			t.Errorf("expected %s = %s; got %s", key, expected, got)
+		}
+	}
+
+	for _, key := range []string{"took", "timed_out", "hits"} {
+		if _, ok := response.Extra[key]; ok {
+			t.Errorf("expected %s not to be in Extra", key)
+		}
+	}
+}
+
+func TestMultiSearchResponseFailures(t *testing.T) {
+	data := []byte(`{"responses": [
+		{"took": 1, "hits": {"total": 1, "hits": [{"_id": "1"}]}},
+		{"error": "IndexMissingException[[nope] missing]", "status": 404},
+		{"took": 2, "hits": {"total": 0, "hits": []}}
+	]}`)
+
+	var response es.MultiSearchResponse
+	if err := json.Unmarshal(data, &response); err != nil {
+		t.Fatal(err)
+	}
+
+	err := response.FirstError()
+	if err == nil {
+		t.Fatal("expected an error, got none")
+	}
+	if expected, got := "search 1: IndexMissingException[[nope] missing] (status 404)", err.Error(); expected != got {
+		t.Errorf("expected error %q; got %q", expected, got)
+	}
+
+	succeeded := response.Succeeded()
+	if expected, got := 2, len(succeeded); expected != got {
+		t.Fatalf("expected %d succeeded; got %d", expected, got)
+	}
+	if expected, got := 1, succeeded[0].Took; expected != got {
+		t.Errorf("expected first succeeded took %d; got %d", expected, got)
+	}
+	if expected, got := 2, succeeded[1].Took; expected != got {
+		t.Errorf("expected second succeeded took %d; got %d", expected, got)
+	}
+
+	if err := (es.MultiSearchResponse{Responses: succeeded}).FirstError(); err != nil {
+		t.Errorf("expected no error; got %s", err)
+	}
+}
+
+func TestSearchResponseEachSource(t *testing.T) {
+	data := []byte(`{"took":1,"hits":{"total":2,"hits":[
+		{"_index":"twitter","_type":"tweet","_id":"1","_score":1.5,"_source":{"user":"kimchy","message":"trying out ElasticSearch"}},
+		{"_index":"twitter","_type":"tweet","_id":"2","_score":0.5,"_source":{"user":"bob","message":"another tweet"}}
+	]}}`)
+
+	var response es.SearchResponse
+	if err := json.Unmarshal(data, &response); err != nil {
+		t.Fatal(err)
+	}
+
+	type tweet struct {
+		User    string `json:"user"`
+		Message string `json:"message"`
+	}
+
+	ids, tweets := []string{}, []tweet{}
+	if err := response.EachSource(func(meta es.HitMeta, raw json.RawMessage) error {
+		var tw tweet
+		if err := json.Unmarshal(raw, &tw); err != nil {
+			return err
+		}
+		ids, tweets = append(ids, meta.ID), append(tweets, tw)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if expected, got := `["1","2"]`, marshalOrError(ids); expected != got {
+		t.Errorf("expected IDs %s; got %s", expected, got)
+	}
+
+	if expected, got := `[{"user":"kimchy","message":"trying out ElasticSearch"},{"user":"bob","message":"another tweet"}]`, marshalOrError(tweets); expected != got {
+		t.Errorf("expected tweets %s; got %s", expected, got)
+	}
+
+	stop := fmt.Errorf("stop")
+	calls := 0
+	if err := response.EachSource(func(es.HitMeta, json.RawMessage) error {
+		calls++
+		return stop
+	}); err != stop {
+		t.Errorf("expected error %v; got %v", stop, err)
+	}
+	if expected, got := 1, calls; expected != got {
+		t.Errorf("expected %d call(s) after an error; got %d", expected, got)
+	}
+}
+
+func TestSearchResponseDecodeAll(t *testing.T) {
+	data := []byte(`{"took":1,"hits":{"total":2,"hits":[
+		{"_index":"twitter","_type":"tweet","_id":"1","_source":{"user":"kimchy","message":"trying out ElasticSearch"}},
+		{"_index":"twitter","_type":"tweet","_id":"2","_source":{"user":"bob","message":"another tweet"}}
+	]}}`)
+
+	var response es.SearchResponse
+	if err := json.Unmarshal(data, &response); err != nil {
+		t.Fatal(err)
+	}
+
+	type Tweet struct {
+		User    string `json:"user"`
+		Message string `json:"message"`
+	}
+
+	var tweets []Tweet
+	if err := response.DecodeAll(&tweets); err != nil {
+		t.Fatal(err)
+	}
+
+	if expected, got := 2, len(tweets); expected != got {
+		t.Fatalf("expected %d tweet(s); got %d", expected, got)
+	}
+
+	if expected, got := (Tweet{"bob", "another tweet"}), tweets[1]; expected != got {
+		t.Errorf("expected %+v; got %+v", expected, got)
+	}
+
+	if err := response.DecodeAll(tweets); err == nil {
+		t.Errorf("expected error decoding into a non-pointer, got none")
+	}
+
+	response.HitsWrapper.Hits[1].Source = nil
+	if err := response.DecodeAll(&[]Tweet{}); err == nil {
+		t.Errorf("expected error decoding a hit without _source, got none")
+	}
+}
+
+func TestFacetResponseTypes(t *testing.T) {
+	data := []byte(`{"took":1,"hits":{"total":3,"hits":[]},"facets":{
+		"users": {
+			"_type": "terms",
+			"missing": 1,
+			"total": 3,
+			"other": 0,
+			"terms": [{"term": "kimchy", "count": 2}, {"term": "bob", "count": 1}]
+		},
+		"rings": {
+			"_type": "geo_distance",
+			"ranges": [
+				{"to": 10, "count": 2, "total_count": 2, "min": 1.5, "max": 8, "total": 9.5, "mean": 4.75},
+				{"from": 10, "to": 20, "count": 1, "total_count": 1, "min": 12, "max": 12, "total": 12, "mean": 12}
+			]
+		},
+		"likes": {
+			"_type": "statistical",
+			"count": 3,
+			"total": 45.5,
+			"min": 5,
+			"max": 30,
+			"mean": 15.166,
+			"sum_of_squares": 1045.25,
+			"variance": 118.41,
+			"std_deviation": 10.88
+		}
+	}}`)
+
+	var response es.SearchResponse
+	if err := json.Unmarshal(data, &response); err != nil {
+		t.Fatal(err)
+	}
+
+	users := response.Facets["users"]
+	if expected, got := 2, len(users.Terms); expected != got {
+		t.Fatalf("expected %d term(s) populated directly; got %d", expected, got)
+	}
+	if expected, got := int64(1), users.Missing; expected != got {
+		t.Errorf("expected missing = %d; got %d", expected, got)
+	}
+	terms, err := users.AsTerms()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected, got := "kimchy", terms.Terms[0].Term; expected != got {
+		t.Errorf("expected first term = %q; got %q", expected, got)
+	}
+
+	rings, err := response.Facets["rings"].AsRange()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected, got := 2, len(rings.Ranges); expected != got {
+		t.Fatalf("expected %d range(s); got %d", expected, got)
+	}
+	if expected, got := int64(2), rings.Ranges[0].TotalCount; expected != got {
+		t.Errorf("expected total_count = %d; got %d", expected, got)
+	}
+	if expected, got := 10.0, rings.Ranges[1].From; expected != got {
+		t.Errorf("expected from = %v; got %v", expected, got)
+	}
+
+	likes, err := response.Facets["likes"].AsStatistical()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected, got := 45.5, likes.Total; expected != got {
+		t.Errorf("expected total = %v; got %v", expected, got)
+	}
+	if expected, got := 10.88, likes.StdDeviation; expected != got {
+		t.Errorf("expected std_deviation = %v; got %v", expected, got)
+	}
+
+	if len(response.Facets["likes"].Terms) != 0 {
+		t.Errorf("expected no terms on a statistical facet")
+	}
+	if _, err := response.Facets["likes"].AsRange(); err == nil {
+		t.Errorf("expected error decoding a statistical facet as a range facet, got none")
+	}
+}
+
+func TestSearchResponseTotal(t *testing.T) {
+	for _, tuple := range []struct {
+		data     string
+		total    int
+		relation string
+	}{
+		{`{"hits":{"total":42,"hits":[]}}`, 42, "eq"},
+		{`{"hits":{"total":{"value":42,"relation":"eq"},"hits":[]}}`, 42, "eq"},
+		{`{"hits":{"total":{"value":10000,"relation":"gte"},"hits":[]}}`, 10000, "gte"},
+		{`{"hits":{"hits":[]}}`, 0, ""},
+	} {
+		var response es.SearchResponse
+		if err := json.Unmarshal([]byte(tuple.data), &response); err != nil {
+			t.Errorf("%s: %s", tuple.data, err)
+			continue
+		}
+
+		if expected, got := tuple.total, response.HitsWrapper.Total; expected != got {
+			t.Errorf("%s: expected total %d; got %d", tuple.data, expected, got)
+		}
+
+		if expected, got := tuple.relation, response.HitsWrapper.TotalRelation; expected != got {
+			t.Errorf("%s: expected relation %q; got %q", tuple.data, expected, got)
+		}
+	}
+}
+
+func TestExplainResponse(t *testing.T) {
+	data := []byte(`{
+		"_index": "twitter",
+		"_type": "tweet",
+		"_id": "1",
+		"matched": true,
+		"explanation": {"value": 0.15, "description": "score(doc=0,freq=1.0)", "details": []}
+	}`)
+
+	var response es.ExplainResponse
+	if err := json.Unmarshal(data, &response); err != nil {
+		t.Fatal(err)
+	}
+
+	if !response.Matched {
+		t.Errorf("expected matched = true")
+	}
+
+	var explanation struct {
+		Value float64 `json:"value"`
+	}
+	if err := json.Unmarshal(response.Explanation, &explanation); err != nil {
+		t.Fatal(err)
+	}
+
+	if expected, got := 0.15, explanation.Value; expected != got {
+		t.Errorf("expected explanation value = %v; got %v", expected, got)
+	}
+}
+
+func TestValidateQueryResponse(t *testing.T) {
+	data := []byte(`{
+		"valid": false,
+		"_shards": {"total": 1, "successful": 1, "failed": 0},
+		"explanations": [{
+			"index": "twitter",
+			"valid": false,
+			"error": "org.elasticsearch.index.query.QueryParsingException: [twitter] Failed to parse"
+		}]
+	}`)
+
+	var response es.ValidateQueryResponse
+	if err := json.Unmarshal(data, &response); err != nil {
+		t.Fatal(err)
+	}
+
+	if response.Valid {
+		t.Errorf("expected valid = false")
+	}
+
+	if expected, got := 1, len(response.Explanations); expected != got {
+		t.Fatalf("expected %d explanation(s); got %d", expected, got)
+	}
+
+	if expected, got := "twitter", response.Explanations[0].Index; expected != got {
+		t.Errorf("expected index = %q; got %q", expected, got)
+	}
+
+	if response.Explanations[0].Error == "" {
+		t.Errorf("expected an error in the explanation")
+	}
+}
+
+func TestMultiSearchResponseIsolation(t *testing.T) {
+	data := []byte(`{"responses": [
+		{"took": 1, "hits": {"total": 1, "hits": [{"_id": "1"}]}},
+		{"error": {"root_cause": [], "type": "index_not_found_exception", "reason": "no such index"}, "status": 404},
+		{"took": 2, "hits": "malformed"},
+		{"took": 3, "hits": {"total": 0, "hits": []}}
+	]}`)
+
+	var response es.MultiSearchResponse
+	if err := json.Unmarshal(data, &response); err != nil {
+		t.Fatal(err)
+	}
+
+	if expected, got := 4, len(response.Responses); expected != got {
+		t.Fatalf("expected %d response(s); got %d", expected, got)
+	}
+
+	if expected, got := "index_not_found_exception: no such index", response.Responses[1].Error; expected != got {
+		t.Errorf("expected error %q; got %q", expected, got)
+	}
+
+	if expected, got := 404, response.Responses[1].Status; expected != got {
+		t.Errorf("expected status %d; got %d", expected, got)
+	}
+
+	if response.Responses[2].Error == "" {
+		t.Errorf("expected an error for the malformed response, got none")
+	}
+
+	if expected, got := 2, len(response.Succeeded()); expected != got {
+		t.Errorf("expected %d succeeded response(s); got %d", expected, got)
+	}
+
+	if expected, got := 3, response.Responses[3].Took; expected != got {
+		t.Errorf("expected the response after the failures to be decoded; got took %d", got)
+	}
+}
+
+func TestSearchResponseRangeAgg(t *testing.T) {
+	data := []byte(`{"took":1,"hits":{"total":7,"hits":[]},"aggregations":{"price_ranges":{"buckets":[
+		{"key":"*-50.0","to":50.0,"doc_count":2},
+		{"key":"50.0-100.0","from":50.0,"to":100.0,"doc_count":4,"avg_price":{"value":74.5}},
+		{"key":"100.0-*","from":100.0,"doc_count":1}
+	]}}}`)
+
+	var response es.SearchResponse
+	if err := json.Unmarshal(data, &response); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := response.RangeAgg("missing"); err == nil {
+		t.Errorf("expected error decoding a missing aggregation, got none")
+	}
+
+	ranges, err := response.RangeAgg("price_ranges")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected, got := 3, len(ranges.Buckets); expected != got {
+		t.Fatalf("expected %d bucket(s); got %d", expected, got)
+	}
+
+	first, middle, last := ranges.Buckets[0], ranges.Buckets[1], ranges.Buckets[2]
+	if first.From != nil || first.To == nil || *first.To != 50 {
+		t.Errorf("expected first bucket to be unbounded below 50; got %v to %v", first.From, first.To)
+	}
+	if last.To != nil || last.From == nil || *last.From != 100 {
+		t.Errorf("expected last bucket to be unbounded above 100; got %v to %v", last.From, last.To)
+	}
+	if expected, got := "50.0-100.0", middle.Key; expected != got {
+		t.Errorf("expected key = %q; got %q", expected, got)
+	}
+	if expected, got := int64(4), middle.DocCount; expected != got {
+		t.Errorf("expected doc_count = %d; got %d", expected, got)
+	}
+	if expected, got := `{"value":74.5}`, string(middle.Aggregations["avg_price"]); expected != got {
+		t.Errorf("expected avg_price = %s; got %s", expected, got)
+	}
+	if len(first.Aggregations) != 0 {
+		t.Errorf("expected no sub-aggregations in the first bucket; got %v", first.Aggregations)
+	}
+}
@@ -1,7 +1,10 @@
 package elasticsearch
 
 import (
+	"bytes"
 	"encoding/json"
+	"fmt"
+	"strings"
 )
 
 // This file contains structures that represent all of the various JSON-
@@ -34,6 +37,23 @@ func (w *Wrapper) MarshalJSON() ([]byte, error) {
 	})
 }
 
+// objectFields marshals the SubQuery, which must render to a JSON object, and
+// returns its top-level keys. It's used when a SubQuery needs to be merged
+// with other keys at the same level.
+func objectFields(q SubQuery) (map[string]json.RawMessage, error) {
+	buf, err := json.Marshal(q)
+	if err != nil {
+		return nil, err
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(buf, &fields); err != nil {
+		return nil, fmt.Errorf("expected a JSON object: %s", err)
+	}
+
+	return fields, nil
+}
+
 //
 //
 //
@@ -61,6 +81,7 @@ type GenericQueryParams struct {
 	Operator           string  `json:"operator,omitempty"`
 	MinimumShouldMatch string  `json:"minimum_should_match,omitempty"`
 	CutoffFrequency    float32 `json:"cutoff_frequency,omitempty"`
+	Fuzziness          string  `json:"fuzziness,omitempty"`
 }
 
 // FieldedGenericQuery returns a SubQuery representing the passed QueryParams
@@ -86,20 +107,134 @@ func MatchQuery(p MatchQueryParams) SubQuery {
 	return p
 }
 
+// FieldMatch is shorthand for the common case of a MatchQuery on a single
+// field, ie. `{"match": {"field": "text"}}`.
+func FieldMatch(field, text string) SubQuery {
+	return MatchQuery(MatchQueryParams{
+		Query: &Wrapper{
+			Name:    field,
+			Wrapped: text,
+		},
+	})
+}
+
+// FieldMatchAdvanced is a MatchQuery on a single field, with options, eg.
+// `{"match": {"field": {"query": "text", "operator": "and"}}}`.
+func FieldMatchAdvanced(field string, p GenericQueryParams) SubQuery {
+	return MatchQuery(MatchQueryParams{
+		Query: FieldedGenericQuery(field, p),
+	})
+}
+
+//
+//
+//
+
+// http://www.elasticsearch.org/guide/reference/query-dsl/query-string-query.html
+// The Query is parsed with the Lucene query syntax. To search for text from an
+// untrusted source, such as a search box, escape it with EscapeQueryString.
+type QueryStringQueryParams struct {
+	Query           string   `json:"query"`
+	DefaultField    string   `json:"default_field,omitempty"`
+	Fields          []string `json:"fields,omitempty"`
+	DefaultOperator string   `json:"default_operator,omitempty"`
+	Analyzer        string   `json:"analyzer,omitempty"`
+}
+
+func QueryStringQuery(p QueryStringQueryParams) SubQuery {
+	return &Wrapper{
+		Name:    "query_string",
+		Wrapped: p,
+	}
+}
+
+// EscapeQueryString backslash-escapes the characters which are special in the
+// Lucene query syntax, so that s is searched for literally.
+func EscapeQueryString(s string) string {
+	var buf bytes.Buffer
+	for _, r := range s {
+		if strings.ContainsRune(queryStringSpecial, r) {
+			buf.WriteRune('\\')
+		}
+		buf.WriteRune(r)
+	}
+	return buf.String()
+}
+
+// queryStringSpecial are the characters escaped by EscapeQueryString. The
+// operators && and || are escaped character by character.
+const queryStringSpecial = `+-&|!(){}[]^"~*?:\/`
+
+//
+//
+//
+
+// http://www.elasticsearch.org/guide/reference/query-dsl/match-query.html
+type MatchPhrasePrefixQueryParams struct {
+	Query         string `json:"query"`
+	MaxExpansions int    `json:"max_expansions,omitempty"`
+	Slop          int    `json:"slop,omitempty"`
+}
+
+// MatchPhrasePrefixQuery applies the passed params to the given field.
+func MatchPhrasePrefixQuery(field string, p MatchPhrasePrefixQueryParams) SubQuery {
+	return &Wrapper{
+		Name: "match_phrase_prefix",
+		Wrapped: &Wrapper{
+			Name:    field,
+			Wrapped: p,
+		},
+	}
+}
+
 //
 //
 //
 
 // http://www.elasticsearch.org/guide/reference/query-dsl/term-query.html
 // Typically `Query` would be &Wrapper{Name: "fieldname", Wrapped: "value"}.
+// If Boost is set, the value is expanded to the object form, ie.
+// `{"term": {"fieldname": {"value": "value", "boost": 2}}}`.
 type TermQueryParams struct {
 	Query SubQuery `json:"term"`
+	Boost float32  `json:"-"`
+}
+
+func (p TermQueryParams) MarshalJSON() ([]byte, error) {
+	if p.Boost == 0 {
+		return json.Marshal(map[string]SubQuery{"term": p.Query})
+	}
+
+	fields, err := objectFields(p.Query)
+	if err != nil {
+		return nil, fmt.Errorf("term query: %s", err)
+	}
+
+	term := map[string]interface{}{}
+	for field, value := range fields {
+		term[field] = map[string]interface{}{
+			"value": value,
+			"boost": p.Boost,
+		}
+	}
+	return json.Marshal(map[string]interface{}{"term": term})
 }
 
 func TermQuery(p TermQueryParams) SubQuery {
 	return p
 }
 
+// FieldTerm is shorthand for the common case of a TermQuery on a single field,
+// ie. `{"term": {"field": "value"}}`.
+func FieldTerm(field, value string) SubQuery {
+	return TermQuery(TermQueryParams{
+		Query: &Wrapper{
+			Name:    field,
+			Wrapped: value,
+		},
+	})
+}
+
 //
 //
 //
@@ -133,19 +268,43 @@ func DisMaxQuery(p DisMaxQueryParams) SubQuery {
 	}
 }
 
+// MultiFieldDisMax matches the text against each of the fields, scoring each
+// document by its best-matching field, plus tieBreaker times the others.
+func MultiFieldDisMax(text string, fields []string, tieBreaker float32) SubQuery {
+	queries := []SubQuery{}
+	for _, field := range fields {
+		queries = append(queries, FieldMatch(field, text))
+	}
+	return DisMaxQuery(DisMaxQueryParams{
+		Queries:    queries,
+		TieBreaker: tieBreaker,
+	})
+}
+
 //
 //
 //
 
 // http://www.elasticsearch.org/guide/reference/query-dsl/bool-query.html
+// Must, Should and MustNot each take either a single SubQuery or a list of
+// them; use Clauses to build the latter.
 type BoolQueryParams struct {
-	Must                     SubQuery `json:"must,omitempty"` // can be slice!
+	Must                     SubQuery `json:"must,omitempty"`
 	Should                   SubQuery `json:"should,omitempty"`
 	MustNot                  SubQuery `json:"must_not,omitempty"`
 	MinimumNumberShouldMatch int      `json:"minimum_number_should_match,omitempty"`
+	MinimumShouldMatch       string   `json:"minimum_should_match,omitempty"` // eg. "75%"; wins over the int
 	Boost                    float32  `json:"boost,omitempty"`
 }
 
+func (p BoolQueryParams) MarshalJSON() ([]byte, error) {
+	type params BoolQueryParams // without this method, to avoid recursion
+	if p.MinimumShouldMatch != "" {
+		p.MinimumNumberShouldMatch = 0
+	}
+	return json.Marshal(params(p))
+}
+
 func BoolQuery(p BoolQueryParams) SubQuery {
 	return &Wrapper{
 		Name:    "bool",
@@ -153,6 +312,19 @@ func BoolQuery(p BoolQueryParams) SubQuery {
 	}
 }
 
+// Clauses combines SubQueries into a single clause of a BoolQuery. A single
+// SubQuery is returned as-is, so it marshals exactly as if it had been used
+// directly; more than one marshals to a list.
+func Clauses(queries ...SubQuery) SubQuery {
+	switch len(queries) {
+	case 0:
+		return nilSubQuery
+	case 1:
+		return queries[0]
+	}
+	return queries
+}
+
 //
 //
 //
@@ -193,6 +365,134 @@ func ConstantScoreQuery(p ConstantScoreQueryParams) SubQuery {
 //
 //
 
+// http://www.elasticsearch.org/guide/reference/query-dsl/filtered-query.html
+type FilteredQueryParams struct {
+	Query  SubQuery       `json:"query,omitempty"`
+	Filter FilterSubQuery `json:"filter,omitempty"`
+}
+
+func FilteredQuery(p FilteredQueryParams) SubQuery {
+	return &Wrapper{
+		Name:    "filtered",
+		Wrapped: p,
+	}
+}
+
+// SearchWithFilters restricts the query to documents matching all of the
+// filters, by combining them in a bool filter within a filtered query. With no
+// filters, the query is returned unchanged.
+func SearchWithFilters(query SubQuery, filters ...FilterSubQuery) SubQuery {
+	if len(filters) <= 0 {
+		return query
+	}
+	return FilteredQuery(FilteredQueryParams{
+		Query:  query,
+		Filter: BoolFilter(BoolFilterParams{Must: filters}),
+	})
+}
+
+//
+//
+//
+
+// http://www.elasticsearch.org/guide/reference/query-dsl/common-terms-query.html
+type CommonTermsQueryParams struct {
+	Query            string  `json:"query"`
+	CutoffFrequency  float32 `json:"cutoff_frequency,omitempty"`
+	LowFreqOperator  string  `json:"low_freq_operator,omitempty"`
+	HighFreqOperator string  `json:"high_freq_operator,omitempty"`
+}
+
+// CommonTermsQuery applies the passed params to the given field.
+func CommonTermsQuery(field string, p CommonTermsQueryParams) SubQuery {
+	return &Wrapper{
+		Name: "common",
+		Wrapped: &Wrapper{
+			Name:    field,
+			Wrapped: p,
+		},
+	}
+}
+
+//
+//
+//
+
+// http://www.elasticsearch.org/guide/reference/query-dsl/indices-query.html
+// NoMatchQuery may also be one of the strings "all" or "none".
+type IndicesQueryParams struct {
+	Indices      []string `json:"indices"`
+	Query        SubQuery `json:"query"`
+	NoMatchQuery SubQuery `json:"no_match_query,omitempty"`
+}
+
+func IndicesQuery(p IndicesQueryParams) SubQuery {
+	return &Wrapper{
+		Name:    "indices",
+		Wrapped: p,
+	}
+}
+
+//
+//
+//
+
+// http://www.elasticsearch.org/guide/reference/query-dsl/span-term-query.html
+func SpanTermQuery(field, value string) SubQuery {
+	return &Wrapper{
+		Name: "span_term",
+		Wrapped: &Wrapper{
+			Name:    field,
+			Wrapped: value,
+		},
+	}
+}
+
+// http://www.elasticsearch.org/guide/reference/query-dsl/span-near-query.html
+// Clauses should themselves be span queries, eg. SpanTermQuery.
+type SpanNearQueryParams struct {
+	Clauses []SubQuery `json:"clauses"`
+	Slop    int        `json:"slop"`
+	InOrder bool       `json:"in_order"`
+}
+
+func SpanNearQuery(p SpanNearQueryParams) SubQuery {
+	return &Wrapper{
+		Name:    "span_near",
+		Wrapped: p,
+	}
+}
+
+// http://www.elasticsearch.org/guide/reference/query-dsl/span-or-query.html
+// Clauses should themselves be span queries, eg. SpanTermQuery.
+func SpanOrQuery(clauses []SubQuery) SubQuery {
+	return &Wrapper{
+		Name: "span_or",
+		Wrapped: struct {
+			Clauses []SubQuery `json:"clauses"`
+		}{clauses},
+	}
+}
+
+// http://www.elasticsearch.org/guide/reference/query-dsl/span-not-query.html
+// Matches of Include which overlap with matches of Exclude are removed. Both
+// should themselves be span queries, eg. SpanTermQuery.
+type SpanNotQueryParams struct {
+	Include SubQuery `json:"include"`
+	Exclude SubQuery `json:"exclude"`
+}
+
+func SpanNotQuery(p SpanNotQueryParams) SubQuery {
+	return &Wrapper{
+		Name:    "span_not",
+		Wrapped: p,
+	}
+}
+
+//
+//
+//
+
 func MatchAllQuery() SubQuery {
 	return &Wrapper{
 		Name:    "match_all",
@@ -200,6 +500,15 @@ func MatchAllQuery() SubQuery {
 	}
 }
 
+// MatchAllQueryBoosted is a MatchAllQuery which gives every document the
+// boost as its score, eg. `{"match_all": {"boost": 2}}`.
+func MatchAllQueryBoosted(boost float32) SubQuery {
+	return &Wrapper{
+		Name:    "match_all",
+		Wrapped: map[string]interface{}{"boost": boost},
+	}
+}
+
 //
 //
 //
@@ -277,6 +586,44 @@ func BooleanFilters(p BooleanFiltersParams) SubQuery {
 //
 //
 
+// http://www.elasticsearch.org/guide/reference/query-dsl/bool-filter.html
+type BoolFilterParams struct {
+	Must               []FilterSubQuery `json:"must,omitempty"`
+	Should             []FilterSubQuery `json:"should,omitempty"`
+	MustNot            []FilterSubQuery `json:"must_not,omitempty"`
+	MinimumShouldMatch int              `json:"minimum_should_match,omitempty"`
+}
+
+func BoolFilter(p BoolFilterParams) FilterSubQuery {
+	return &Wrapper{
+		Name:    "bool",
+		Wrapped: p,
+	}
+}
+
+//
+//
+//
+
+// http://www.elasticsearch.org/guide/reference/query-dsl/indices-filter.html
+// NoMatchFilter may also be one of the strings "all" or "none".
+type IndicesFilterParams struct {
+	Indices       []string       `json:"indices"`
+	Filter        FilterSubQuery `json:"filter"`
+	NoMatchFilter FilterSubQuery `json:"no_match_filter,omitempty"`
+}
+
+func IndicesFilter(p IndicesFilterParams) FilterSubQuery {
+	return &Wrapper{
+		Name:    "indices",
+		Wrapped: p,
+	}
+}
+
+//
+//
+//
+
 type QueryFilterParams struct {
 	Query SubQuery `json:"query"`
 }
@@ -340,6 +687,11 @@ func FieldedFilter(fieldName string, p FieldedFilterParams) FilterSubQuery {
 	}
 }
 
+// http://www.elasticsearch.org/guide/reference/query-dsl/type-filter.html
+func TypeFilter(typeName string) FilterSubQuery {
+	return FieldedFilter("type", FieldedFilterParams{Value: typeName})
+}
+
 //
 //
 //
@@ -352,6 +704,10 @@ type RangeFilterParams struct {
 	To           string `json:"to,omitempty"`
 	IncludeLower bool   `json:"include_lower"`
 	IncludeUpper bool   `json:"include_upper"`
+
+	// Format and TimeZone only apply to ranges on date fields.
+	Format   string `json:"format,omitempty"`
+	TimeZone string `json:"time_zone,omitempty"`
 }
 
 func FieldedRangeSubQuery(field string, p RangeFilterParams) RangeSubQuery {
@@ -361,6 +717,27 @@ func FieldedRangeSubQuery(field string, p RangeFilterParams) RangeSubQuery {
 	}
 }
 
+// RangeParams express a range with the gt/gte/lt/lte keys, which newer
+// versions of ElasticSearch prefer over from/to/include_lower/include_upper.
+// Unlike RangeFilterParams, unset bounds are omitted entirely.
+type RangeParams struct {
+	GT  string `json:"gt,omitempty"`
+	GTE string `json:"gte,omitempty"`
+	LT  string `json:"lt,omitempty"`
+	LTE string `json:"lte,omitempty"`
+
+	// Format and TimeZone only apply to ranges on date fields.
+	Format   string `json:"format,omitempty"`
+	TimeZone string `json:"time_zone,omitempty"`
+}
+
+func FieldedRange(field string, p RangeParams) RangeSubQuery {
+	return &Wrapper{
+		Name:    field,
+		Wrapped: p,
+	}
+}
+
 func RangeFilter(q RangeSubQuery) FilterSubQuery {
 	return &Wrapper{
 		Name:    "range",
@@ -368,6 +745,14 @@ func RangeFilter(q RangeSubQuery) FilterSubQuery {
 	}
 }
 
+// http://www.elasticsearch.org/guide/reference/query-dsl/range-query.html
+func RangeQuery(q RangeSubQuery) SubQuery {
+	return &Wrapper{
+		Name:    "range",
+		Wrapped: q,
+	}
+}
+
 //
 //
 //
@@ -393,6 +778,39 @@ func TermsFacet(p TermsFacetParams) FacetSubQuery {
 	}
 }
 
+// http://www.elasticsearch.org/guide/reference/api/search/facets/geo-distance-facet.html
+// Field is a geo_point field, and each range is a distance from Lat, Lon, in
+// Unit (eg. "km"). A zero From or To leaves that end of the range unbounded.
+type GeoDistanceFacetParams struct {
+	Field    string
+	Lat, Lon float64
+	Unit     string
+	Ranges   []DistanceRange
+}
+
+type DistanceRange struct {
+	From float64 `json:"from,omitempty"`
+	To   float64 `json:"to,omitempty"`
+}
+
+func (p GeoDistanceFacetParams) MarshalJSON() ([]byte, error) {
+	facet := map[string]interface{}{
+		p.Field:  map[string]float64{"lat": p.Lat, "lon": p.Lon},
+		"ranges": p.Ranges,
+	}
+	if p.Unit != "" {
+		facet["unit"] = p.Unit
+	}
+	return json.Marshal(facet)
+}
+
+func GeoDistanceFacet(p GeoDistanceFacetParams) FacetSubQuery {
+	return &Wrapper{
+		Name:    "geo_distance",
+		Wrapped: p,
+	}
+}
+
 // TODO other types of facets
 
 // NamedFacet wraps any FooFacet SubQuery so that it can be used
@@ -403,3 +821,201 @@ func NamedFacet(name string, q FacetSubQuery) FacetSubQuery {
 		Wrapped: q,
 	}
 }
+
+//
+//
+//
+// =============================================================================
+// HERE BE AGGREGATIONS
+// =============================================================================
+//
+//
+//
+
+type AggregationSubQuery SubQuery
+
+// Aggregation gives a name to an aggregation, like TermsAgg, and optionally
+// nests sub-aggregations beneath it. Sub-aggregations are computed within each
+// bucket of the parent.
+type Aggregation struct {
+	Name string
+	Agg  AggregationSubQuery
+	Aggs Aggregations
+}
+
+// Aggregations marshal to the object expected under the "aggs" key of a
+// search body, ie. `{"name": {"terms": {...}, "aggs": {...}}}`.
+type Aggregations []Aggregation
+
+func (a Aggregations) MarshalJSON() ([]byte, error) {
+	m := map[string]interface{}{}
+	for _, agg := range a {
+		if agg.Agg == nil {
+			return nil, fmt.Errorf("aggregation %q: no aggregation type", agg.Name)
+		}
+		body, err := objectFields(agg.Agg)
+		if err != nil {
+			return nil, fmt.Errorf("aggregation %q: %s", agg.Name, err)
+		}
+		if body == nil {
+			return nil, fmt.Errorf("aggregation %q: no aggregation type", agg.Name)
+		}
+		if len(agg.Aggs) > 0 {
+			sub, err := json.Marshal(agg.Aggs)
+			if err != nil {
+				return nil, err
+			}
+			body["aggs"] = sub
+		}
+		m[agg.Name] = body
+	}
+	return json.Marshal(m)
+}
+
+// http://www.elasticsearch.org/guide/reference/api/search/aggregations/bucket/terms-aggregation/
+type TermsAggParams struct {
+	Field string `json:"field"`
+	Size  int    `json:"size,omitempty"`
+}
+
+func TermsAgg(p TermsAggParams) AggregationSubQuery {
+	return &Wrapper{
+		Name:    "terms",
+		Wrapped: p,
+	}
+}
+
+// http://www.elasticsearch.org/guide/reference/api/search/aggregations/bucket/datehistogram-aggregation/
+type DateHistogramAggParams struct {
+	Field    string `json:"field"`
+	Interval string `json:"interval"`
+	Format   string `json:"format,omitempty"`
+}
+
+func DateHistogramAgg(p DateHistogramAggParams) AggregationSubQuery {
+	return &Wrapper{
+		Name:    "date_histogram",
+		Wrapped: p,
+	}
+}
+
+// http://www.elasticsearch.org/guide/reference/api/search/aggregations/metrics/stats-aggregation/
+type StatsAggParams struct {
+	Field string `json:"field"`
+}
+
+func StatsAgg(p StatsAggParams) AggregationSubQuery {
+	return &Wrapper{
+		Name:    "stats",
+		Wrapped: p,
+	}
+}
+
+// http://www.elasticsearch.org/guide/reference/api/search/aggregations/bucket/range-aggregation/
+// Each of the Ranges is a bucket. Decode the buckets with SearchResponse's
+// RangeAgg method.
+type RangeAggParams struct {
+	Field  string     `json:"field"`
+	Ranges []AggRange `json:"ranges"`
+}
+
+// AggRange is a range of values, including From and excluding To. A nil From
+// or To leaves that end of the range unbounded. Key optionally names the
+// range's bucket.
+type AggRange struct {
+	Key  string   `json:"key,omitempty"`
+	From *float64 `json:"from,omitempty"`
+	To   *float64 `json:"to,omitempty"`
+}
+
+func RangeAgg(p RangeAggParams) AggregationSubQuery {
+	return &Wrapper{
+		Name:    "range",
+		Wrapped: p,
+	}
+}
+
+// FilterAgg narrows the documents in scope to those matching the filter. It's
+// only useful with sub-aggregations.
+func FilterAgg(f FilterSubQuery) AggregationSubQuery {
+	return &Wrapper{
+		Name:    "filter",
+		Wrapped: f,
+	}
+}
+
+//
+//
+//
+// =============================================================================
+// HERE BE SUGGESTERS
+// =============================================================================
+//
+//
+//
+
+type SuggestSubQuery SubQuery
+
+// Suggester gives a name to a suggester, like TermSuggester, and the text to
+// make suggestions for.
+type Suggester struct {
+	Name      string
+	Text      string
+	Suggester SuggestSubQuery
+}
+
+// Suggest marshals to the object expected under the "suggest" key of a search
+// body, ie. `{"name": {"text": "...", "term": {...}}}`.
+type Suggest []Suggester
+
+func (s Suggest) MarshalJSON() ([]byte, error) {
+	m := map[string]interface{}{}
+	for _, suggester := range s {
+		if suggester.Suggester == nil {
+			return nil, fmt.Errorf("suggester %q: no suggester type", suggester.Name)
+		}
+		body, err := objectFields(suggester.Suggester)
+		if err != nil {
+			return nil, fmt.Errorf("suggester %q: %s", suggester.Name, err)
+		}
+		if body == nil {
+			return nil, fmt.Errorf("suggester %q: no suggester type", suggester.Name)
+		}
+		text, err := json.Marshal(suggester.Text)
+		if err != nil {
+			return nil, err
+		}
+		body["text"] = text
+		m[suggester.Name] = body
+	}
+	return json.Marshal(m)
+}
+
+// http://www.elasticsearch.org/guide/reference/api/search/term-suggest/
+type TermSuggesterParams struct {
+	Field       string `json:"field"`
+	Size        int    `json:"size,omitempty"`
+	SuggestMode string `json:"suggest_mode,omitempty"`
+}
+
+func TermSuggester(p TermSuggesterParams) SuggestSubQuery {
+	return &Wrapper{
+		Name:    "term",
+		Wrapped: p,
+	}
+}
+
+// http://www.elasticsearch.org/guide/reference/api/search/phrase-suggest/
+type PhraseSuggesterParams struct {
+	Field     string  `json:"field"`
+	Size      int     `json:"size,omitempty"`
+	GramSize  int     `json:"gram_size,omitempty"`
+	MaxErrors float32 `json:"max_errors,omitempty"`
+}
+
+func PhraseSuggester(p PhraseSuggesterParams) SuggestSubQuery {
+	return &Wrapper{
+		Name:    "phrase",
+		Wrapped: p,
+	}
+}